@@ -0,0 +1,196 @@
+package fileaddrhandler
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"strings"
+)
+
+// HashAlgorithm 摘要算法
+type HashAlgorithm string
+
+const (
+	// HashAlgorithmMD5 MD5
+	HashAlgorithmMD5 HashAlgorithm = "md5"
+	// HashAlgorithmSHA1 SHA-1
+	HashAlgorithmSHA1 HashAlgorithm = "sha1"
+	// HashAlgorithmSHA256 SHA-256
+	HashAlgorithmSHA256 HashAlgorithm = "sha256"
+	// HashAlgorithmSHA512 SHA-512
+	HashAlgorithmSHA512 HashAlgorithm = "sha512"
+	// HashAlgorithmSM3 国密SM3
+	HashAlgorithmSM3 HashAlgorithm = "sm3"
+)
+
+// newHash 创建摘要计算
+func (h HashAlgorithm) newHash() (hash.Hash, error) {
+	switch h {
+	case HashAlgorithmMD5:
+		return md5.New(), nil
+	case HashAlgorithmSHA1:
+		return sha1.New(), nil
+	case HashAlgorithmSHA256:
+		return sha256.New(), nil
+	case HashAlgorithmSHA512:
+		return sha512.New(), nil
+	case HashAlgorithmSM3:
+		return newSm3(), nil
+	default:
+		return nil, ErrOption.Errorf("不支持的摘要算法[%s]", h)
+	}
+}
+
+// Checksum 期望的文件摘要
+type Checksum struct {
+	// Algorithm 摘要算法
+	Algorithm HashAlgorithm
+	// Value 16进制的摘要值, 不区分大小写
+	Value string
+}
+
+// checksumOptionData 从json选项数据中解析期望的摘要
+type checksumOptionData struct {
+	Checksum *Checksum
+}
+
+// parseChecksumOptionData 解析json选项数据中的 Checksum 字段, 非json数据时返回nil
+func parseChecksumOptionData(d any) (*Checksum, error) {
+	var data []byte
+	switch t := d.(type) {
+	case string:
+		data = []byte(t)
+	case []byte:
+		data = t
+	default:
+		return nil, nil
+	}
+
+	if !json.Valid(data) {
+		return nil, nil
+	}
+
+	var res *checksumOptionData
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, ErrOption.ErrorWithRawErrf(err, "解析选项中的摘要失败: %s", err.Error())
+	}
+
+	if res == nil {
+		return nil, nil
+	}
+	return res.Checksum, nil
+}
+
+// CopyResult 拷贝结果
+type CopyResult struct {
+	// FileType 识别出的文件类型
+	FileType FileType
+	// Size 拷贝的字节数
+	Size int64
+	// Checksums 请求的摘要结果, 设置了期望摘要时包含其算法, 值为小写的16进制字符串
+	Checksums map[HashAlgorithm]string
+	// Location 目标实际写出的位置, 目标处理器未提供时为空
+	Location string
+	// Outcome 目标的写出结果, 目标处理器未提供时为空
+	Outcome WriteOutcome
+}
+
+// checksumReader 读取过程中计算摘要的读取流
+type checksumReader struct {
+	r      io.Reader
+	w      io.Writer
+	algs   []HashAlgorithm
+	hashes []hash.Hash
+	n      int64
+	// expected 期望的摘要, 读取结束时校验
+	expected *Checksum
+	// verifyErr 摘要校验失败的错误
+	verifyErr error
+	verified  bool
+}
+
+// newChecksumReader 创建计算摘要的读取流, 重复的算法只计算一次, expected 不为空时同时计算其算法的摘要
+func newChecksumReader(r io.Reader, expected *Checksum, algorithms ...HashAlgorithm) (*checksumReader, error) {
+	cr := &checksumReader{r: r, expected: expected}
+	if expected != nil {
+		algorithms = append(algorithms, expected.Algorithm)
+	}
+
+	writers := make([]io.Writer, 0, len(algorithms))
+	seen := make(map[HashAlgorithm]struct{}, len(algorithms))
+	for _, alg := range algorithms {
+		if _, ok := seen[alg]; ok {
+			continue
+		}
+		seen[alg] = struct{}{}
+
+		h, err := alg.newHash()
+		if err != nil {
+			return nil, err
+		}
+		cr.algs = append(cr.algs, alg)
+		cr.hashes = append(cr.hashes, h)
+		writers = append(writers, h)
+	}
+	cr.w = io.MultiWriter(writers...)
+	return cr, nil
+}
+
+// Read 实现io.Reader接口
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.n += int64(n)
+		_, _ = c.w.Write(p[:n])
+	}
+
+	if err == io.EOF {
+		if verifyErr := c.verify(); verifyErr != nil {
+			return n, verifyErr
+		}
+	}
+	return n, err
+}
+
+// sum 获取指定算法的摘要
+func (c *checksumReader) sum(alg HashAlgorithm) string {
+	for i, a := range c.algs {
+		if a == alg {
+			return hex.EncodeToString(c.hashes[i].Sum(nil))
+		}
+	}
+	return ""
+}
+
+// verify 校验期望的摘要, 只在首次调用时计算
+func (c *checksumReader) verify() error {
+	if c.expected == nil || c.verified {
+		return c.verifyErr
+	}
+
+	c.verified = true
+	actual := c.sum(c.expected.Algorithm)
+	if !strings.EqualFold(actual, strings.TrimSpace(c.expected.Value)) {
+		c.verifyErr = ErrCodeChecksumMismatch.Errorf("文件%s摘要[%s]与期望值[%s]不一致", c.expected.Algorithm, actual, c.expected.Value)
+	}
+	return c.verifyErr
+}
+
+// result 生成拷贝结果
+func (c *checksumReader) result(ft FileType) *CopyResult {
+	res := &CopyResult{FileType: ft, Size: c.n}
+	if len(c.algs) == 0 {
+		return res
+	}
+
+	res.Checksums = make(map[HashAlgorithm]string, len(c.algs))
+	for _, alg := range c.algs {
+		res.Checksums[alg] = c.sum(alg)
+	}
+	return res
+}
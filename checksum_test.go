@@ -0,0 +1,125 @@
+package fileaddrhandler
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParser_CopyWithResult(t *testing.T) {
+	a := assert.New(t)
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	md5Sum := md5.Sum(srcBytes)
+	sha1Sum := sha1.Sum(srcBytes)
+	sha256Sum := sha256.Sum256(srcBytes)
+	sha512Sum := sha512.Sum512(srcBytes)
+	sm3Hash := newSm3()
+	_, _ = sm3Hash.Write(srcBytes)
+
+	expected := map[HashAlgorithm]string{
+		HashAlgorithmMD5:    hex.EncodeToString(md5Sum[:]),
+		HashAlgorithmSHA1:   hex.EncodeToString(sha1Sum[:]),
+		HashAlgorithmSHA256: hex.EncodeToString(sha256Sum[:]),
+		HashAlgorithmSHA512: hex.EncodeToString(sha512Sum[:]),
+		HashAlgorithmSM3:    hex.EncodeToString(sm3Hash.Sum(nil)),
+	}
+
+	server := httptest.NewServer(&testRangeServer{data: srcBytes})
+	defer server.Close()
+
+	parser := New(FileTypePDF)
+	buf := &bytes.Buffer{}
+	res, err := parser.CopyWithResult(WithEmptySourceOption().SetUri(server.URL+"/"+srcFile), WithEmptyTargetOption().SetWriter(buf),
+		HashAlgorithmMD5, HashAlgorithmSHA1, HashAlgorithmSHA256, HashAlgorithmSHA512, HashAlgorithmSM3, HashAlgorithmSM3)
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, res.FileType) || !a.Equal(int64(len(srcBytes)), res.Size) || !a.Equal(expected, res.Checksums) || !a.Equal(srcBytes, buf.Bytes()) {
+		return
+	}
+
+	res, data, err := parser.CopyToBytesWithResult(WithEmptySourceOption().SetUri("file://"+srcFile), HashAlgorithmSM3)
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, res.FileType) || !a.Equal(expected[HashAlgorithmSM3], res.Checksums[HashAlgorithmSM3]) || !a.Equal(srcBytes, []byte(data)) {
+		return
+	}
+
+	res, err = parser.CopyWithResult(WithEmptySourceOption().SetReader(bytes.NewReader(srcBytes)), WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Nil(res.Checksums) {
+		return
+	}
+
+	_, err = parser.CopyWithResult(WithEmptySourceOption().SetReader(bytes.NewReader(srcBytes)), WithEmptyTargetOption().SetWriter(ioutil.Discard), "crc32")
+	a.True(ErrOption.Equal(err))
+}
+
+func TestParser_ChecksumVerify(t *testing.T) {
+	a := assert.New(t)
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	sha256Sum := sha256.Sum256(srcBytes)
+	sm3Hash := newSm3()
+	_, _ = sm3Hash.Write(srcBytes)
+
+	server := httptest.NewServer(&testRangeServer{data: srcBytes})
+	defer server.Close()
+
+	parser := New(FileTypePDF)
+	targetPath := filepath.Join(t.TempDir(), "checksum", "target.pdf")
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri(server.URL+"/"+srcFile).SetChecksum(HashAlgorithmSHA256, strings.Repeat("0", 64)),
+		WithEmptyTargetOption().SetUri("file://"+targetPath))
+	if !a.True(ErrCodeChecksumMismatch.Equal(err)) || !a.NoFileExists(targetPath) {
+		return
+	}
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetReader(bytes.NewReader(srcBytes)).SetChecksum(HashAlgorithmSHA256, strings.ToUpper(hex.EncodeToString(sha256Sum[:]))),
+		WithEmptyTargetOption().SetUri("file://"+targetPath))
+	if !a.NoError(err) || !a.FileExists(targetPath) {
+		return
+	}
+
+	optionData := `{"Method":"GET","Checksum":{"Algorithm":"sm3","Value":"` + hex.EncodeToString(sm3Hash.Sum(nil)) + `"}}`
+	res, data, err := parser.CopyToBytesWithResult(WithAnySourceOption(optionData).SetUri(server.URL + "/" + srcFile))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(srcBytes, []byte(data)) || !a.Equal(hex.EncodeToString(sm3Hash.Sum(nil)), res.Checksums[HashAlgorithmSM3]) {
+		return
+	}
+
+	_, _, err = parser.CopyToBytesWithOption(WithAnySourceOption(`{"Checksum":{"Algorithm":"md5","Value":"00"}}`).SetUri(server.URL + "/" + srcFile))
+	if !a.True(ErrCodeChecksumMismatch.Equal(err)) {
+		return
+	}
+
+	_, _, err = parser.CopyToBytesWithOption(WithAnySourceOption(`{"Checksum":"md5"}`).SetUri(server.URL + "/" + srcFile))
+	a.True(ErrOption.Equal(err))
+}
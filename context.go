@@ -0,0 +1,115 @@
+package fileaddrhandler
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// requestContext 获取请求携带的上下文, 为空时返回 context.Background
+func requestContext(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+// contextError 上下文结束时将错误转换为 ErrCodeContextDone, 否则原样返回
+func contextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		if ErrCodeContextDone.Equal(err) {
+			return err
+		}
+		return ErrCodeContextDone.ErrorWithRawErrf(ctxErr, "操作已取消: %s", ctxErr.Error())
+	}
+	return err
+}
+
+// contextReader 上下文结束后读取即返回错误的读取流
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read 实现io.Reader接口
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, ErrCodeContextDone.ErrorWithRawErrf(err, "操作已取消: %s", err.Error())
+	}
+	return c.r.Read(p)
+}
+
+// contextReadSeeker 保留原始读取流重新定位能力的 contextReader
+type contextReadSeeker struct {
+	*contextReader
+	io.Seeker
+}
+
+// withContextReader 包装读取流, 上下文不可取消时原样返回
+func withContextReader(ctx context.Context, r io.Reader) io.Reader {
+	if ctx.Done() == nil {
+		return r
+	}
+
+	cr := &contextReader{ctx: ctx, r: r}
+	if seeker, ok := r.(io.Seeker); ok {
+		return &contextReadSeeker{contextReader: cr, Seeker: seeker}
+	}
+	return cr
+}
+
+// contextCloser 上下文结束时关闭已登记的连接, 用于中断阻塞中的网络读写
+type contextCloser struct {
+	lock    sync.Mutex
+	closers []io.Closer
+	closed  bool
+	stop    chan struct{}
+}
+
+// watchContext 监听上下文, 上下文不可取消时返回的监听器不做任何处理
+func watchContext(ctx context.Context) *contextCloser {
+	c := &contextCloser{stop: make(chan struct{})}
+	if ctx.Done() == nil {
+		return c
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			c.closed = true
+			for _, closer := range c.closers {
+				_ = closer.Close()
+			}
+		case <-c.stop:
+		}
+	}()
+	return c
+}
+
+// add 登记需要关闭的连接, 上下文已结束时立即关闭
+func (c *contextCloser) add(closer io.Closer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		_ = closer.Close()
+		return
+	}
+	c.closers = append(c.closers, closer)
+}
+
+// Stop 停止监听
+func (c *contextCloser) Stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+	}
+}
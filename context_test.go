@@ -0,0 +1,134 @@
+package fileaddrhandler
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// testCancelWriter 首次写出时取消上下文的写出流
+type testCancelWriter struct {
+	cancel context.CancelFunc
+	n      int
+}
+
+func (w *testCancelWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	w.n += len(p)
+	return len(p), nil
+}
+
+func TestParser_CopyContext(t *testing.T) {
+	defer os.RemoveAll(targetFile)
+
+	a := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	parser := New(FileTypePDF)
+	_, err := parser.CopyByURIContext(ctx, "file://"+srcFile, "file://"+targetFile)
+	if !a.True(ErrCodeContextDone.Equal(err)) {
+		return
+	}
+
+	_, _, err = parser.CopyToBytesContext(ctx, "file://"+srcFile)
+	if !a.True(ErrCodeContextDone.Equal(err)) {
+		return
+	}
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	w := &testCancelWriter{cancel: cancel}
+	_, err = parser.CopyContext(ctx, bytes.NewReader(srcBytes), w)
+	if !a.True(ErrCodeContextDone.Equal(err)) {
+		return
+	}
+
+	a.Less(w.n, len(srcBytes))
+}
+
+func TestParser_CopyContextHttp(t *testing.T) {
+	a := assert.New(t)
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(srcBytes[:1024])
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	parser := New(FileTypePDF)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err = parser.CopyToBytesContext(ctx, server.URL+"/"+srcFile)
+	if !a.True(ErrCodeContextDone.Equal(err)) || !a.Less(time.Since(start), 5*time.Second) {
+		return
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start = time.Now()
+	_, err = parser.CopyByURIContext(ctx, "file://"+srcFile, server.URL+"/upload")
+	if !a.True(ErrCodeContextDone.Equal(err)) {
+		return
+	}
+
+	a.Less(time.Since(start), 5*time.Second)
+}
+
+func TestParser_CopyContextFtp(t *testing.T) {
+	a := assert.New(t)
+
+	server := newTestFtpServer(t)
+	defer server.Close()
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.NoError(ioutil.WriteFile(server.localPath(srcFile), srcBytes, 0644)) {
+		return
+	}
+
+	parser := New(FileTypePDF)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &testCancelWriter{cancel: cancel}
+	_, err = parser.CopyWithOptionContext(ctx, WithEmptySourceOption().SetUri(server.URL("/"+srcFile)), WithEmptyTargetOption().SetWriter(w))
+	if !a.True(ErrCodeContextDone.Equal(err)) {
+		return
+	}
+
+	a.Less(w.n, len(srcBytes))
+}
@@ -97,4 +97,18 @@ const (
 	ErrCodeEmptyStream
 	// ErrOption 错误的选项
 	ErrOption
+	// ErrCodeFtpConnect 连接ftp服务失败
+	ErrCodeFtpConnect
+	// ErrCodeSftpConnect 连接sftp服务失败
+	ErrCodeSftpConnect
+	// ErrCodeContextDone 上下文已取消或超时
+	ErrCodeContextDone
+	// ErrCodeFileSize 文件大小不符合限制
+	ErrCodeFileSize
+	// ErrCodeChecksumMismatch 文件摘要与期望值不一致
+	ErrCodeChecksumMismatch
+	// ErrCodeFileExists 目标文件已存在
+	ErrCodeFileExists
+	// ErrCodeEmptyFile 源文件内容为空
+	ErrCodeEmptyFile
 )
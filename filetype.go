@@ -3,29 +3,304 @@ package fileaddrhandler
 import (
 	"encoding/hex"
 	"strings"
+	"sync"
 )
 
-// FileType 文件类型
+// FileType 文件类型, 内置类型为类型名称, PDF沿用早期版本的16进制文件头以保持兼容, 未注册的类型按16进制的文件头前缀识别
 type FileType string
 
+// Is 判断16进制的文件头是否为该类型
 func (f *FileType) Is(t string) bool {
-	return strings.HasPrefix(t, string(*f))
+	header, err := hex.DecodeString(t)
+	if err != nil {
+		return strings.HasPrefix(t, string(*f))
+	}
+	return f.match(header) > 0
 }
 
 var (
-	FileEmpty   FileType = ""
-	FileTypePDF FileType = "255044462d312e"
+	FileEmpty    FileType = ""
+	FileTypePDF  FileType = "255044462d312e"
+	FileTypePNG  FileType = "png"
+	FileTypeJPEG FileType = "jpeg"
+	FileTypeGIF  FileType = "gif"
+	FileTypeTIFF FileType = "tiff"
+	FileTypeBMP  FileType = "bmp"
+	FileTypeWebP FileType = "webp"
+	FileTypeZIP  FileType = "zip"
+	FileTypeGZIP FileType = "gzip"
+	FileType7Z   FileType = "7z"
+	FileTypeRAR  FileType = "rar"
+	FileTypeOLE2 FileType = "ole2"
+	FileTypeRTF  FileType = "rtf"
+	FileTypeXML  FileType = "xml"
+	FileTypeOFD  FileType = "ofd"
+	FileTypeTAR  FileType = "tar"
+	FileTypeISO  FileType = "iso"
+	FileTypeMP4  FileType = "mp4"
 )
 
-func byteToHex(src []byte) string {
-	if src == nil || len(src) <= 0 {
-		return ""
+// FileTypeInfo 文件类型描述
+type FileTypeInfo struct {
+	// Type 类型标识
+	Type FileType
+	// Name 类型名称
+	Name string
+	// MimeType 标准MIME类型
+	MimeType string
+	// Extensions 扩展名, 不含.
+	Extensions []string
+	// Signatures 16进制的文件头魔数, ?? 匹配任意字节, 与 Patterns 任一匹配即为该类型
+	Signatures []string
+	// Patterns 带偏移及掩码的魔数, 与 Signatures 任一匹配即为该类型
+	Patterns []Signature
+}
+
+// Signature 带偏移及掩码的文件头魔数
+type Signature struct {
+	// Offset 魔数在文件中的偏移
+	Offset int
+	// Magic 16进制的魔数, ?? 匹配任意字节
+	Magic string
+	// Mask 16进制的掩码, 长度需与魔数一致, 文件内容与掩码按位与后再与魔数比较, 为空时完全匹配
+	Mask string
+}
+
+var (
+	// fileTypeLock 文件类型注册表锁
+	fileTypeLock sync.RWMutex
+	// fileTypeRegistry 文件类型注册表
+	fileTypeRegistry = map[FileType]*fileTypeEntry{}
+)
+
+// fileTypeEntry 注册表中的文件类型, 魔数已解析
+type fileTypeEntry struct {
+	info       FileTypeInfo
+	signatures []signature
+}
+
+// signature 解析后的魔数
+type signature struct {
+	offset int
+	magic  []byte
+	mask   []byte
+	// weight 参与比较的字节个数, 多个类型同时匹配时取较大者
+	weight int
+}
+
+// parseSignature 解析魔数, ?? 对应的掩码为0
+func parseSignature(s Signature) (signature, error) {
+	magic := strings.ToLower(strings.ReplaceAll(s.Magic, " ", ""))
+	if len(magic) == 0 || len(magic)%2 != 0 || s.Offset < 0 {
+		return signature{}, ErrOption.Errorf("非法的文件头魔数[%s]", s.Magic)
+	}
+
+	sig := signature{offset: s.Offset, magic: make([]byte, len(magic)/2), mask: make([]byte, len(magic)/2)}
+	for i := 0; i < len(magic); i += 2 {
+		if magic[i:i+2] == "??" {
+			continue
+		}
+
+		if _, err := hex.Decode(sig.magic[i/2:i/2+1], []byte(magic[i:i+2])); err != nil {
+			return signature{}, ErrOption.ErrorWithRawErrf(err, "非法的文件头魔数[%s]: %s", s.Magic, err.Error())
+		}
+		sig.mask[i/2] = 0xff
+	}
+
+	if s.Mask != "" {
+		mask, err := hex.DecodeString(strings.ReplaceAll(s.Mask, " ", ""))
+		if err != nil || len(mask) != len(sig.mask) {
+			return signature{}, ErrOption.Errorf("非法的文件头魔数掩码[%s]", s.Mask)
+		}
+
+		for i := range mask {
+			sig.mask[i] &= mask[i]
+		}
 	}
 
-	if len(src) > 10 {
-		src = src[:10]
+	for i := range sig.mask {
+		sig.magic[i] &= sig.mask[i]
+		if sig.mask[i] != 0 {
+			sig.weight++
+		}
 	}
+	return sig, nil
+}
 
-	return hex.EncodeToString(src)
+// size 匹配需要的文件头长度
+func (s signature) size() int {
+	return s.offset + len(s.magic)
+}
+
+// match 匹配文件头, 返回匹配的权重, 不匹配时为0
+func (s signature) match(header []byte) int {
+	if len(header) < s.size() {
+		return 0
+	}
 
+	header = header[s.offset:]
+	for i, b := range s.magic {
+		if header[i]&s.mask[i] != b {
+			return 0
+		}
+	}
+	return s.weight
 }
+
+// RegisterFileType 注册文件类型, 已存在时覆盖
+func RegisterFileType(info FileTypeInfo) error {
+	if info.Type == "" {
+		return ErrOption.Error("文件类型标识不能为空")
+	}
+
+	if len(info.Signatures) == 0 && len(info.Patterns) == 0 {
+		return ErrOption.Errorf("文件类型[%s]缺少文件头魔数", info.Type)
+	}
+
+	patterns := make([]Signature, 0, len(info.Signatures)+len(info.Patterns))
+	for _, s := range info.Signatures {
+		patterns = append(patterns, Signature{Magic: s})
+	}
+	patterns = append(patterns, info.Patterns...)
+
+	entry := &fileTypeEntry{info: info}
+	for _, s := range patterns {
+		sig, err := parseSignature(s)
+		if err != nil {
+			return err
+		}
+		entry.signatures = append(entry.signatures, sig)
+	}
+
+	fileTypeLock.Lock()
+	defer fileTypeLock.Unlock()
+	fileTypeRegistry[info.Type] = entry
+	return nil
+}
+
+// LookupFileType 获取已注册的文件类型描述
+func LookupFileType(f FileType) (FileTypeInfo, bool) {
+	if entry := f.entry(); entry != nil {
+		return entry.info, true
+	}
+	return FileTypeInfo{}, false
+}
+
+// FileTypeByExtension 通过扩展名获取已注册的文件类型, 不区分大小写, 可带.
+func FileTypeByExtension(ext string) (FileType, bool) {
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+
+	fileTypeLock.RLock()
+	defer fileTypeLock.RUnlock()
+	for t, entry := range fileTypeRegistry {
+		for _, e := range entry.info.Extensions {
+			if strings.ToLower(e) == ext {
+				return t, true
+			}
+		}
+	}
+	return FileEmpty, false
+}
+
+// entry 获取注册表中的类型
+func (f FileType) entry() *fileTypeEntry {
+	fileTypeLock.RLock()
+	defer fileTypeLock.RUnlock()
+	return fileTypeRegistry[f]
+}
+
+// match 匹配文件头, 返回匹配的权重, 不匹配时为0, 未注册的类型按16进制前缀匹配
+func (f FileType) match(header []byte) int {
+	entry := f.entry()
+	if entry == nil {
+		if f != FileEmpty && strings.HasPrefix(hex.EncodeToString(header), strings.ToLower(string(f))) {
+			return len(f) / 2
+		}
+		return 0
+	}
+
+	weight := 0
+	for _, sig := range entry.signatures {
+		if w := sig.match(header); w > weight {
+			weight = w
+		}
+	}
+	return weight
+}
+
+// headerSize 识别该类型需要的文件头长度
+func (f FileType) headerSize() int {
+	entry := f.entry()
+	if entry == nil {
+		return len(f) / 2
+	}
+
+	size := 0
+	for _, sig := range entry.signatures {
+		if n := sig.size(); n > size {
+			size = n
+		}
+	}
+	return size
+}
+
+// Name 获取文件类型名称, 未注册的类型返回类型标识
+func (f FileType) Name() string {
+	if entry := f.entry(); entry != nil {
+		return entry.info.Name
+	}
+	return string(f)
+}
+
+// MimeType 获取文件类型对应的MIME类型, 未知类型返回 application/octet-stream
+func (f FileType) MimeType() string {
+	if entry := f.entry(); entry != nil && entry.info.MimeType != "" {
+		return entry.info.MimeType
+	}
+	return "application/octet-stream"
+}
+
+// Extensions 获取文件类型的扩展名, 未知类型返回nil
+func (f FileType) Extensions() []string {
+	if entry := f.entry(); entry != nil {
+		return entry.info.Extensions
+	}
+	return nil
+}
+
+// builtinFileTypes 内置的文件类型
+var builtinFileTypes = []FileTypeInfo{
+	{Type: FileTypePDF, Name: "PDF", MimeType: "application/pdf", Extensions: []string{"pdf"}, Signatures: []string{"255044462d312e", "255044462d322e"}},
+	{Type: FileTypePNG, Name: "PNG", MimeType: "image/png", Extensions: []string{"png"}, Signatures: []string{"89504e470d0a1a0a"}},
+	{Type: FileTypeJPEG, Name: "JPEG", MimeType: "image/jpeg", Extensions: []string{"jpg", "jpeg", "jpe"}, Signatures: []string{"ffd8ff"}},
+	{Type: FileTypeGIF, Name: "GIF", MimeType: "image/gif", Extensions: []string{"gif"}, Signatures: []string{"474946383761", "474946383961"}},
+	{Type: FileTypeTIFF, Name: "TIFF", MimeType: "image/tiff", Extensions: []string{"tif", "tiff"}, Signatures: []string{"49492a00", "4d4d002a"}},
+	{Type: FileTypeBMP, Name: "BMP", MimeType: "image/bmp", Extensions: []string{"bmp"}, Signatures: []string{"424d"}},
+	{Type: FileTypeWebP, Name: "WebP", MimeType: "image/webp", Extensions: []string{"webp"}, Signatures: []string{"52494646????????57454250"}},
+	{Type: FileTypeZIP, Name: "ZIP", MimeType: "application/zip", Extensions: []string{"zip"}, Signatures: []string{"504b0304", "504b0506", "504b0708"}},
+	{Type: FileTypeGZIP, Name: "GZIP", MimeType: "application/gzip", Extensions: []string{"gz", "tgz"}, Signatures: []string{"1f8b08"}},
+	{Type: FileType7Z, Name: "7z", MimeType: "application/x-7z-compressed", Extensions: []string{"7z"}, Signatures: []string{"377abcaf271c"}},
+	{Type: FileTypeRAR, Name: "RAR", MimeType: "application/vnd.rar", Extensions: []string{"rar"}, Signatures: []string{"526172211a0700", "526172211a070100"}},
+	{Type: FileTypeOLE2, Name: "OLE2 (DOC/XLS)", MimeType: "application/x-ole-storage", Extensions: []string{"doc", "xls", "ppt"}, Signatures: []string{"d0cf11e0a1b11ae1"}},
+	{Type: FileTypeRTF, Name: "RTF", MimeType: "application/rtf", Extensions: []string{"rtf"}, Signatures: []string{"7b5c727466"}},
+	{Type: FileTypeXML, Name: "XML", MimeType: "application/xml", Extensions: []string{"xml"}, Signatures: []string{"3c3f786d6c", "efbbbf3c3f786d6c"}},
+	// OFD 为ZIP格式, 首个条目为 OFD.xml
+	{Type: FileTypeOFD, Name: "OFD", MimeType: "application/ofd", Extensions: []string{"ofd"}, Signatures: []string{"504b0304" + strings.Repeat("??", 26) + "4f46442e786d6c"}},
+	// TAR 的 ustar 标识位于第257字节, 兼容POSIX及GNU格式
+	{Type: FileTypeTAR, Name: "TAR", MimeType: "application/x-tar", Extensions: []string{"tar"}, Patterns: []Signature{{Offset: 257, Magic: "7573746172"}}},
+	// ISO 9660 的卷描述符标识位于第32769字节
+	{Type: FileTypeISO, Name: "ISO 9660", MimeType: "application/x-iso9660-image", Extensions: []string{"iso"}, Patterns: []Signature{{Offset: 32769, Magic: "4344303031"}}},
+	// MP4 的 ftyp 盒位于第4字节
+	{Type: FileTypeMP4, Name: "MP4", MimeType: "video/mp4", Extensions: []string{"mp4", "m4v", "m4a"}, Patterns: []Signature{{Offset: 4, Magic: "66747970"}}},
+}
+
+func init() {
+	for _, info := range builtinFileTypes {
+		if err := RegisterFileType(info); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// fileHeaderSize 识别文件类型读取的文件头最小长度, 支持的类型需要更多字节时按需加长
+const fileHeaderSize = 10
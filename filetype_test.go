@@ -1,9 +1,17 @@
 package fileaddrhandler
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
 	"github.com/stretchr/testify/assert"
+	"image"
+	"image/png"
 	"io/ioutil"
 	"testing"
+	"testing/iotest"
 )
 
 func TestFileTypeParse(t *testing.T) {
@@ -14,9 +22,183 @@ func TestFileTypeParse(t *testing.T) {
 		return
 	}
 
-	fType := byteToHex(fileBytes)
+	fType := hex.EncodeToString(fileBytes[:fileHeaderSize])
 
 	if a.True(FileTypePDF.Is(fType), "文件类型不匹配") {
 		return
 	}
 }
+
+func TestFileTypeRegistry(t *testing.T) {
+	a := assert.New(t)
+
+	zipData := func(name string) []byte {
+		buf := &bytes.Buffer{}
+		w := zip.NewWriter(buf)
+		f, err := w.Create(name)
+		if err == nil {
+			_, err = f.Write([]byte("<ofd/>"))
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		a.NoError(err)
+		return buf.Bytes()
+	}
+
+	pngBuf := &bytes.Buffer{}
+	if !a.NoError(png.Encode(pngBuf, image.NewGray(image.Rect(0, 0, 1, 1)))) {
+		return
+	}
+
+	gzipBuf := &bytes.Buffer{}
+	gw := gzip.NewWriter(gzipBuf)
+	_, _ = gw.Write([]byte("gzip"))
+	if !a.NoError(gw.Close()) {
+		return
+	}
+
+	pdfBytes, err := ioutil.ReadFile("test.pdf")
+	if !a.NoError(err) {
+		return
+	}
+
+	padding := bytes.Repeat([]byte{0}, 16)
+	samples := map[FileType][]byte{
+		FileTypePDF:  pdfBytes,
+		FileTypePNG:  pngBuf.Bytes(),
+		FileTypeJPEG: append([]byte{0xff, 0xd8, 0xff, 0xe0}, padding...),
+		FileTypeGIF:  append([]byte("GIF89a"), padding...),
+		FileTypeTIFF: append([]byte{'M', 'M', 0, 0x2a}, padding...),
+		FileTypeBMP:  append([]byte("BM"), padding...),
+		FileTypeWebP: append([]byte("RIFF\x10\x00\x00\x00WEBPVP8 "), padding...),
+		FileTypeZIP:  zipData("a.txt"),
+		FileTypeGZIP: gzipBuf.Bytes(),
+		FileType7Z:   append([]byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}, padding...),
+		FileTypeRAR:  append([]byte("Rar!\x1a\x07\x01\x00"), padding...),
+		FileTypeOLE2: append([]byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}, padding...),
+		FileTypeRTF:  []byte(`{\rtf1\ansi hello}`),
+		FileTypeXML:  []byte(`<?xml version="1.0"?><a/>`),
+		FileTypeOFD:  zipData("OFD.xml"),
+	}
+
+	all := make([]FileType, 0, len(samples))
+	for ft := range samples {
+		all = append(all, ft)
+	}
+
+	parser := New(all...)
+	for expected, data := range samples {
+		ft, _, err := parser.CopyToBytesWithOption(WithEmptySourceOption().SetReader(bytes.NewReader(data)))
+		if !a.NoError(err, expected) || !a.Equal(expected, ft) {
+			return
+		}
+	}
+
+	info, ok := LookupFileType(FileTypeOFD)
+	if !a.True(ok) || !a.Equal("application/ofd", info.MimeType) || !a.Equal("OFD", FileTypeOFD.Name()) {
+		return
+	}
+
+	ft, ok := FileTypeByExtension(".JPG")
+	if !a.True(ok) || !a.Equal(FileTypeJPEG, ft) || !a.Equal("image/jpeg", ft.MimeType()) {
+		return
+	}
+
+	// 未注册的16进制前缀类型保持原有的识别方式
+	legacy := FileType("25504446")
+	ft, _, err = New(legacy).CopyToBytesWithOption(WithEmptySourceOption().SetReader(bytes.NewReader(pdfBytes)))
+	if !a.NoError(err) || !a.Equal(legacy, ft) || !a.Equal("application/octet-stream", ft.MimeType()) {
+		return
+	}
+
+	custom := FileType("test-custom")
+	if !a.True(ErrOption.Equal(RegisterFileType(FileTypeInfo{Type: custom, Signatures: []string{"zz"}}))) {
+		return
+	}
+
+	if !a.NoError(RegisterFileType(FileTypeInfo{Type: custom, Name: "Custom", MimeType: "application/x-custom", Extensions: []string{"cst"}, Signatures: []string{"43??5354"}})) {
+		return
+	}
+
+	ft, _, err = New(custom).CopyToBytesWithOption(WithEmptySourceOption().SetReader(bytes.NewReader([]byte("CXST-data"))))
+	if !a.NoError(err) || !a.Equal(custom, ft) {
+		return
+	}
+
+	parser.AddSupportTypes(custom)
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetReader(bytes.NewReader([]byte("unknown data"))), WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	a.True(ErrCodeUnsupportedFileType.Equal(err))
+}
+
+func TestFileTypeSignaturePatterns(t *testing.T) {
+	a := assert.New(t)
+
+	tarBuf := &bytes.Buffer{}
+	tw := tar.NewWriter(tarBuf)
+	if !a.NoError(tw.WriteHeader(&tar.Header{Name: "a.txt", Mode: 0644, Size: 3})) {
+		return
+	}
+	_, _ = tw.Write([]byte("tar"))
+	if !a.NoError(tw.Close()) {
+		return
+	}
+
+	iso := make([]byte, 40*1024)
+	copy(iso[32769:], "CD001")
+
+	mp4 := append([]byte{0, 0, 0, 0x18}, []byte("ftypisom")...)
+	mp4 = append(mp4, bytes.Repeat([]byte{0}, 16)...)
+
+	parser := New(FileTypePDF, FileTypeTAR, FileTypeISO, FileTypeMP4)
+	for expected, data := range map[FileType][]byte{FileTypeTAR: tarBuf.Bytes(), FileTypeISO: iso, FileTypeMP4: mp4} {
+		buf := &bytes.Buffer{}
+		ft, err := parser.CopyWithOption(WithEmptySourceOption().SetReader(iotest.HalfReader(bytes.NewReader(data))), WithEmptyTargetOption().SetWriter(buf))
+		if !a.NoError(err, expected) || !a.Equal(expected, ft) || !a.Equal(data, buf.Bytes()) {
+			return
+		}
+	}
+
+	// 短于最长魔数的文件仍可按已读取的内容识别
+	pdfBytes, err := ioutil.ReadFile("test.pdf")
+	if !a.NoError(err) {
+		return
+	}
+
+	ft, err := parser.CopyWithOption(WithEmptySourceOption().SetReader(bytes.NewReader(pdfBytes[:1024])), WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.NoError(err) || !a.Equal(FileTypePDF, ft) {
+		return
+	}
+
+	masked := FileType("test-masked")
+	if !a.True(ErrOption.Equal(RegisterFileType(FileTypeInfo{Type: masked, Patterns: []Signature{{Offset: 1, Magic: "f0", Mask: "f0ff"}}}))) {
+		return
+	}
+
+	if !a.NoError(RegisterFileType(FileTypeInfo{Type: masked, Patterns: []Signature{{Offset: 1, Magic: "f0", Mask: "f0"}, {Offset: 2, Magic: "aa??bb"}}})) {
+		return
+	}
+
+	parser = New(masked)
+	for _, data := range [][]byte{{0x00, 0xf3}, {0x00, 0x00, 0xaa, 0x01, 0xbb}} {
+		ft, err = parser.CopyWithOption(WithEmptySourceOption().SetReader(bytes.NewReader(data)), WithEmptyTargetOption().SetWriter(ioutil.Discard))
+		if !a.NoError(err) || !a.Equal(masked, ft) {
+			return
+		}
+	}
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetReader(bytes.NewReader([]byte{0x00, 0x0f, 0x00})), WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	a.True(ErrCodeUnsupportedFileType.Equal(err))
+}
+
+func TestFileTypePDFCompatible(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(FileType("255044462d312e"), FileTypePDF)
+	a.Equal("PDF", FileTypePDF.Name())
+	a.Equal("application/pdf", FileTypePDF.MimeType())
+
+	ft, ok := FileTypeByExtension(".pdf")
+	a.True(ok)
+	a.Equal(FileTypePDF, ft)
+}
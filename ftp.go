@@ -0,0 +1,433 @@
+package fileaddrhandler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ftpDialTimeout ftp连接超时时间
+const ftpDialTimeout = 30 * time.Second
+
+// SourceFtpOption 原始文件的ftp选项
+type SourceFtpOption struct {
+	// Active 是否使用主动模式, 默认为被动模式
+	Active bool
+}
+
+// TargetFtpOption 目标文件的ftp选项
+type TargetFtpOption struct {
+	// Active 是否使用主动模式, 默认为被动模式
+	Active bool
+	// Overwrite 目标文件已存在时是否覆盖, 不覆盖时返回 ErrCodeFileExists
+	Overwrite bool
+}
+
+// ftpConn ftp控制连接
+type ftpConn struct {
+	conn    *textproto.Conn
+	raw     net.Conn
+	active  bool
+	ctx     context.Context
+	watcher *contextCloser
+}
+
+// dialFtp 连接ftp服务并完成登录, 用户名与密码取自uri中的用户信息, 未设置时使用匿名登录
+func dialFtp(ctx context.Context, u *url.URL, active bool) (*ftpConn, error) {
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "21")
+	}
+
+	dialer := &net.Dialer{Timeout: ftpDialTimeout}
+	raw, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, ErrCodeFtpConnect.ErrorWithRawErrf(err, "连接ftp服务[%s]失败: %s", addr, err.Error())
+	}
+
+	c := &ftpConn{
+		conn:    textproto.NewConn(raw),
+		raw:     raw,
+		active:  active,
+		ctx:     ctx,
+		watcher: watchContext(ctx),
+	}
+	c.watcher.add(raw)
+
+	if _, _, err = c.conn.ReadResponse(220); err != nil {
+		c.close()
+		return nil, ErrCodeFtpConnect.ErrorWithRawErrf(err, "ftp服务响应异常: %s", err.Error())
+	}
+
+	user, password := "anonymous", "anonymous"
+	if u.User != nil {
+		user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			password = p
+		}
+	}
+
+	if err = c.login(user, password); err != nil {
+		c.close()
+		return nil, ErrCodeFtpConnect.ErrorWithRawErrf(err, "ftp登录失败: %s", err.Error())
+	}
+
+	if _, _, err = c.cmd(200, "TYPE I"); err != nil {
+		c.close()
+		return nil, ErrCodeFtpConnect.ErrorWithRawErrf(err, "设置ftp二进制传输模式失败: %s", err.Error())
+	}
+	return c, nil
+}
+
+// cmd 发送命令并读取响应
+func (c *ftpConn) cmd(expectCode int, format string, args ...any) (int, string, error) {
+	if _, err := c.conn.Cmd(format, args...); err != nil {
+		return 0, "", err
+	}
+	return c.conn.ReadResponse(expectCode)
+}
+
+// login 登录
+func (c *ftpConn) login(user, password string) error {
+	code, msg, err := c.cmd(0, "USER %s", user)
+	if err != nil {
+		return err
+	}
+
+	switch code {
+	case 230:
+		return nil
+	case 331:
+		if _, _, err = c.cmd(230, "PASS %s", password); err != nil {
+			return err
+		}
+		return nil
+	default:
+		return &textproto.Error{Code: code, Msg: msg}
+	}
+}
+
+// quit 退出并关闭连接
+func (c *ftpConn) quit() {
+	_, _ = c.conn.Cmd("QUIT")
+	c.close()
+}
+
+// close 停止监听上下文并关闭连接
+func (c *ftpConn) close() {
+	c.watcher.Stop()
+	_ = c.conn.Close()
+}
+
+// passiveAddr 通过EPSV或PASV获取被动模式的数据连接地址
+func (c *ftpConn) passiveAddr() (string, error) {
+	host, _, err := net.SplitHostPort(c.raw.RemoteAddr().String())
+	if err != nil {
+		return "", err
+	}
+
+	if _, msg, err := c.cmd(229, "EPSV"); err == nil {
+		start, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)")
+		if start < 0 || end < start+4 {
+			return "", fmt.Errorf("无法解析的EPSV响应: %s", msg)
+		}
+		return net.JoinHostPort(host, msg[start+4:end]), nil
+	}
+
+	_, msg, err := c.cmd(227, "PASV")
+	if err != nil {
+		return "", err
+	}
+
+	start, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("无法解析的PASV响应: %s", msg)
+	}
+
+	fields := strings.Split(msg[start+1:end], ",")
+	if len(fields) != 6 {
+		return "", fmt.Errorf("无法解析的PASV响应: %s", msg)
+	}
+
+	p1, err1 := strconv.Atoi(strings.TrimSpace(fields[4]))
+	p2, err2 := strconv.Atoi(strings.TrimSpace(fields[5]))
+	if err1 != nil || err2 != nil {
+		return "", fmt.Errorf("无法解析的PASV响应: %s", msg)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(p1<<8|p2)), nil
+}
+
+// activeListen 主动模式下监听本地端口并通过PORT或EPRT告知服务端
+func (c *ftpConn) activeListen() (net.Listener, error) {
+	localIp := c.raw.LocalAddr().(*net.TCPAddr).IP
+	ln, err := net.Listen("tcp", net.JoinHostPort(localIp.String(), "0"))
+	if err != nil {
+		return nil, err
+	}
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	if ip4 := localIp.To4(); ip4 != nil {
+		_, _, err = c.cmd(200, "PORT %d,%d,%d,%d,%d,%d", ip4[0], ip4[1], ip4[2], ip4[3], port>>8, port&0xff)
+	} else {
+		_, _, err = c.cmd(200, "EPRT |2|%s|%d|", localIp.String(), port)
+	}
+
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// openData 打开数据连接并发送传输命令
+func (c *ftpConn) openData(format string, args ...any) (*ftpDataConn, error) {
+	var (
+		conn net.Conn
+		ln   net.Listener
+		err  error
+	)
+
+	if c.active {
+		if ln, err = c.activeListen(); err != nil {
+			return nil, err
+		}
+		defer ln.Close()
+		c.watcher.add(ln)
+	} else {
+		addr, err := c.passiveAddr()
+		if err != nil {
+			return nil, err
+		}
+		dialer := &net.Dialer{Timeout: ftpDialTimeout}
+		if conn, err = dialer.DialContext(c.ctx, "tcp", addr); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, _, err = c.cmd(1, format, args...); err != nil {
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, err
+	}
+
+	if ln != nil {
+		if tcpLn, ok := ln.(*net.TCPListener); ok {
+			_ = tcpLn.SetDeadline(time.Now().Add(ftpDialTimeout))
+		}
+		if conn, err = ln.Accept(); err != nil {
+			return nil, err
+		}
+	}
+
+	c.watcher.add(conn)
+	return &ftpDataConn{Conn: conn, c: c}, nil
+}
+
+// retr 下载文件
+func (c *ftpConn) retr(p string) (*ftpDataConn, error) {
+	return c.openData("RETR %s", p)
+}
+
+// stor 上传文件
+func (c *ftpConn) stor(p string) (*ftpDataConn, error) {
+	return c.openData("STOR %s", p)
+}
+
+// size 通过SIZE命令获取文件大小
+func (c *ftpConn) size(p string) (int64, error) {
+	_, msg, err := c.cmd(213, "SIZE %s", p)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+}
+
+// exists 通过SIZE命令判断文件是否存在
+func (c *ftpConn) exists(p string) (bool, error) {
+	_, _, err := c.cmd(213, "SIZE %s", p)
+	if err == nil {
+		return true, nil
+	}
+	if isFtpNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// mkdirAll 逐级创建远程目录, 已存在的目录会被忽略
+func (c *ftpConn) mkdirAll(dir string) {
+	dir = path.Clean(dir)
+	if dir == "/" || dir == "." {
+		return
+	}
+	c.mkdirAll(path.Dir(dir))
+	_, _, _ = c.cmd(257, "MKD %s", dir)
+}
+
+// ftpDataConn ftp数据连接, 关闭时读取传输完成的响应
+type ftpDataConn struct {
+	net.Conn
+	c *ftpConn
+	// eof 是否已读取到数据连接结尾
+	eof bool
+}
+
+// Read 实现io.Reader接口
+func (d *ftpDataConn) Read(p []byte) (int, error) {
+	n, err := d.Conn.Read(p)
+	if err == io.EOF {
+		d.eof = true
+	}
+	return n, err
+}
+
+// Close 关闭数据连接并确认传输结果
+func (d *ftpDataConn) Close() error {
+	if err := d.Conn.Close(); err != nil {
+		return err
+	}
+	_, _, err := d.c.conn.ReadResponse(2)
+	return err
+}
+
+// abort 未读取完成时关闭数据连接, 忽略服务端因连接被提前关闭返回的426/451响应
+func (d *ftpDataConn) abort() error {
+	err := d.Close()
+	if e, ok := err.(*textproto.Error); ok && (e.Code == 426 || e.Code == 451) {
+		return nil
+	}
+	return err
+}
+
+// isFtpNotFound 判断ftp错误是否为文件不存在
+func isFtpNotFound(err error) bool {
+	e, ok := err.(*textproto.Error)
+	return ok && e.Code == 550
+}
+
+// readFtpSource 读取ftp协议文件
+func readFtpSource(req *SourceRequest, fn func(r io.Reader) error) error {
+	var (
+		option *SourceFtpOption
+		err    error
+		u      = req.URL
+	)
+	if option, err = parseOptionData[SourceFtpOption](req.Data); err != nil {
+		return err
+	}
+
+	if option == nil {
+		option = &SourceFtpOption{}
+	}
+
+	c, err := dialFtp(requestContext(req.Context), u, option.Active)
+	if err != nil {
+		return err
+	}
+	defer c.quit()
+
+	if size, err := c.size(u.Path); err == nil {
+		req.Size = size
+	}
+
+	data, err := c.retr(u.Path)
+	if err != nil {
+		if isFtpNotFound(err) {
+			return ErrCodeProtoFileNoExist.ErrorWithRawErrf(err, "ftp资源[%s]不存在", u.Path)
+		}
+		return ErrCodeProtoFileOpen.ErrorWithRawErrf(err, "打开ftp资源[%s]失败: %s", u.Path, err.Error())
+	}
+
+	if err = fn(data); err != nil {
+		_ = data.Conn.Close()
+		return err
+	}
+
+	// 目标提前结束读取时, 由目标返回实际的错误
+	closeData := data.Close
+	if !data.eof {
+		closeData = data.abort
+	}
+
+	if err = closeData(); err != nil {
+		return ErrCodeProtoFileRead.ErrorWithRawErrf(err, "ftp资源[%s]读取失败: %s", u.Path, err.Error())
+	}
+	return nil
+}
+
+// ftpLazyWriter 首次写出时才创建目录并发起上传, 避免文件类型校验失败时在服务端留下空文件
+type ftpLazyWriter struct {
+	c    *ftpConn
+	path string
+	data *ftpDataConn
+}
+
+// Write 实现io.Writer接口
+func (w *ftpLazyWriter) Write(b []byte) (int, error) {
+	if w.data == nil {
+		w.c.mkdirAll(path.Dir(w.path))
+		data, err := w.c.stor(w.path)
+		if err != nil {
+			return 0, err
+		}
+		w.data = data
+	}
+	return w.data.Write(b)
+}
+
+// writeFtpTarget 写出到ftp协议地址
+func writeFtpTarget(req *TargetRequest, r io.Reader) (FileType, error) {
+	var (
+		option *TargetFtpOption
+		err    error
+		u      = req.URL
+	)
+	if option, err = parseOptionData[TargetFtpOption](req.Data); err != nil {
+		return "", err
+	}
+
+	if option == nil {
+		option = &TargetFtpOption{}
+	}
+
+	c, err := dialFtp(requestContext(req.Context), u, option.Active)
+	if err != nil {
+		return "", err
+	}
+	defer c.quit()
+
+	if !option.Overwrite {
+		exists, err := c.exists(u.Path)
+		if err != nil {
+			return "", ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "检查ftp目标文件[%s]失败: %s", u.Path, err.Error())
+		}
+		if exists {
+			return "", ErrCodeFileExists.Errorf("ftp目标文件[%s]已存在", u.Path)
+		}
+	}
+
+	w := &ftpLazyWriter{c: c, path: u.Path}
+	fileType, err := req.Copy(r, w)
+	if w.data == nil {
+		return fileType, err
+	}
+
+	closeErr := w.data.Close()
+	if err != nil {
+		_, _, _ = c.cmd(250, "DELE %s", u.Path)
+		return "", err
+	}
+
+	if closeErr != nil {
+		return "", ErrCodeTargetFileWrite.ErrorWithRawErrf(closeErr, "向ftp目标文件[%s]写出内容失败: %s", u.Path, closeErr.Error())
+	}
+	return fileType, nil
+}
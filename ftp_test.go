@@ -0,0 +1,315 @@
+package fileaddrhandler
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testFtpServer 测试使用的简易ftp服务
+type testFtpServer struct {
+	ln   net.Listener
+	root string
+}
+
+func newTestFtpServer(t *testing.T) *testFtpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testFtpServer{ln: ln, root: t.TempDir()}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testFtpServer) Close() {
+	_ = s.ln.Close()
+}
+
+func (s *testFtpServer) URL(p string) string {
+	return "ftp://test:123456@" + s.ln.Addr().String() + p
+}
+
+func (s *testFtpServer) localPath(p string) string {
+	return filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+p)))
+}
+
+func (s *testFtpServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...any) {
+		_, _ = fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+
+	var (
+		user     string
+		pasvLn   net.Listener
+		portAddr string
+	)
+
+	dataConn := func() (net.Conn, error) {
+		if pasvLn != nil {
+			defer func() { pasvLn = nil }()
+			defer pasvLn.Close()
+			return pasvLn.Accept()
+		}
+		return net.Dial("tcp", portAddr)
+	}
+
+	reply("220 test ftp server")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		cmd, arg := line, ""
+		if i := strings.Index(line, " "); i > 0 {
+			cmd, arg = line[:i], line[i+1:]
+		}
+
+		switch strings.ToUpper(cmd) {
+		case "USER":
+			user = arg
+			reply("331 password required")
+		case "PASS":
+			if user != "test" || arg != "123456" {
+				reply("530 login incorrect")
+				continue
+			}
+			reply("230 logged in")
+		case "TYPE":
+			reply("200 type set")
+		case "EPSV":
+			pasvLn, _ = net.Listen("tcp", "127.0.0.1:0")
+			reply("229 entering extended passive mode (|||%d|)", pasvLn.Addr().(*net.TCPAddr).Port)
+		case "PORT":
+			f := strings.Split(arg, ",")
+			p1, _ := strconv.Atoi(f[4])
+			p2, _ := strconv.Atoi(f[5])
+			portAddr = net.JoinHostPort(strings.Join(f[:4], "."), strconv.Itoa(p1<<8|p2))
+			reply("200 port ok")
+		case "SIZE":
+			stat, err := os.Stat(s.localPath(arg))
+			if err != nil || stat.IsDir() {
+				reply("550 no such file")
+				continue
+			}
+			reply("213 %d", stat.Size())
+		case "MKD":
+			if err := os.Mkdir(s.localPath(arg), 0755); err != nil {
+				reply("550 mkdir failed")
+				continue
+			}
+			reply("257 created")
+		case "DELE":
+			if err := os.Remove(s.localPath(arg)); err != nil {
+				reply("550 delete failed")
+				continue
+			}
+			reply("250 deleted")
+		case "RETR":
+			f, err := os.Open(s.localPath(arg))
+			if err != nil {
+				reply("550 no such file")
+				continue
+			}
+			reply("150 opening data connection")
+			d, err := dataConn()
+			if err != nil {
+				f.Close()
+				reply("425 can't open data connection")
+				continue
+			}
+			_, err = io.Copy(d, f)
+			f.Close()
+			d.Close()
+			if err != nil {
+				// 客户端提前关闭数据连接
+				reply("426 connection closed; transfer aborted")
+				continue
+			}
+			reply("226 transfer complete")
+		case "STOR":
+			f, err := os.Create(s.localPath(arg))
+			if err != nil {
+				reply("553 can't create file")
+				continue
+			}
+			reply("150 opening data connection")
+			d, err := dataConn()
+			if err != nil {
+				f.Close()
+				reply("425 can't open data connection")
+				continue
+			}
+			_, _ = io.Copy(f, d)
+			f.Close()
+			d.Close()
+			reply("226 transfer complete")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+func TestParser_FtpProtoRead(t *testing.T) {
+	defer os.RemoveAll(targetFile)
+
+	a := assert.New(t)
+
+	server := newTestFtpServer(t)
+	defer server.Close()
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.NoError(ioutil.WriteFile(server.localPath(srcFile), srcBytes, 0644)) {
+		return
+	}
+
+	parser := New(FileTypePDF)
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri(server.URL("/"+targetFile)), WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.True(ErrCodeProtoFileNoExist.Equal(err)) {
+		return
+	}
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri("ftp://test:bad@"+server.ln.Addr().String()+"/"+srcFile), WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.True(ErrCodeFtpConnect.Equal(err)) {
+		return
+	}
+
+	ft, err := parser.CopyByURI(server.URL("/"+srcFile), "file://"+targetFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) {
+		return
+	}
+
+	targetBytes, err := ioutil.ReadFile(targetFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(srcBytes, targetBytes) {
+		return
+	}
+
+	ft, buf, err := parser.CopyToBytesWithOption(WithFtpSourceOption(&SourceFtpOption{Active: true}).SetUri(server.URL("/" + srcFile)))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) {
+		return
+	}
+
+	if !a.Equal(srcBytes, []byte(buf)) {
+		return
+	}
+
+	// 目标提前结束读取时返回目标的错误, 而非数据连接被中断的错误
+	large := make([]byte, 32*1024*1024)
+	if !a.NoError(ioutil.WriteFile(server.localPath("large.bin"), large, 0644)) {
+		return
+	}
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri(server.URL("/large.bin")), WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.True(ErrCodeUnsupportedFileType.Equal(err), "%v", err) {
+		return
+	}
+
+	copy(large, srcBytes)
+	if !a.NoError(ioutil.WriteFile(server.localPath("large.pdf"), large, 0644)) {
+		return
+	}
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri(server.URL("/large.pdf")),
+		WithEmptyTargetOption().SetWriter(ioutil.Discard).SetSizeLimit(0, int64(len(srcBytes))))
+	a.True(ErrCodeFileSize.Equal(err), "%v", err)
+}
+
+func TestCopyToFtp(t *testing.T) {
+	a := assert.New(t)
+
+	server := newTestFtpServer(t)
+	defer server.Close()
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	parser := New(FileTypePDF)
+
+	targetUri := server.URL("/in/sub/" + targetFile)
+	ft, err := parser.CopyByURI("file://"+srcFile, targetUri)
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) {
+		return
+	}
+
+	targetBytes, err := ioutil.ReadFile(server.localPath("/in/sub/" + targetFile))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(srcBytes, targetBytes) {
+		return
+	}
+
+	_, err = parser.CopyByURI("file://"+srcFile, targetUri)
+	if !a.True(ErrCodeFileExists.Equal(err)) {
+		return
+	}
+
+	ft, err = parser.CopyWithOption(WithEmptySourceOption().SetUri("file://"+srcFile),
+		WithFtpTargetOption(&TargetFtpOption{Active: true, Overwrite: true}).SetUri(targetUri))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) {
+		return
+	}
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetReader(strings.NewReader("not a pdf file")),
+		WithEmptyTargetOption().SetUri(server.URL("/other.pdf")))
+	if !a.True(ErrCodeUnsupportedFileType.Equal(err)) {
+		return
+	}
+
+	_, err = os.Stat(server.localPath("/other.pdf"))
+	a.True(os.IsNotExist(err))
+}
@@ -0,0 +1,175 @@
+package fileaddrhandler
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SourceRequest 源文件协议请求
+type SourceRequest struct {
+	// Uri 解码后的协议地址
+	Uri string
+	// URL 解析后的地址
+	URL *url.URL
+	// Data 选项携带的数据
+	Data any
+	// Parser 当前解析器
+	Parser *Parser
+	// Context 请求上下文, 结束时应中断读取
+	Context context.Context
+	// Size 源文件大小, 处理器在调用 fn 前设置, 用于进度回调, 未知时为-1
+	Size int64
+	// ModTime 源文件修改时间, 处理器在调用 fn 前设置, 未知时为零值
+	ModTime time.Time
+}
+
+// SourceHandler 源文件协议处理器
+type SourceHandler interface {
+	// Open 打开源文件并将读取流交给 fn 处理
+	Open(req *SourceRequest, fn func(r io.Reader) error) error
+}
+
+// SourceHandlerFunc 函数形式的源文件协议处理器
+type SourceHandlerFunc func(req *SourceRequest, fn func(r io.Reader) error) error
+
+// Open 实现 SourceHandler 接口
+func (f SourceHandlerFunc) Open(req *SourceRequest, fn func(r io.Reader) error) error {
+	return f(req, fn)
+}
+
+// TargetRequest 目标文件协议请求
+type TargetRequest struct {
+	// Uri 解码后的协议地址
+	Uri string
+	// URL 解析后的地址
+	URL *url.URL
+	// Data 选项携带的数据
+	Data any
+	// Parser 当前解析器
+	Parser *Parser
+	// Context 请求上下文, 结束时应中断写出
+	Context context.Context
+	// ModTime 源文件修改时间, 未知时为零值
+	ModTime time.Time
+	// Location 实际写出的位置, 处理器在写出完成后设置, 未设置时为空
+	Location string
+	// Outcome 写出结果, 处理器在写出完成后设置, 未设置时为空
+	Outcome WriteOutcome
+}
+
+// Copy 拷贝读取流并完成文件类型校验, 处理器写出时应通过此方法拷贝, 读取流已应用解析器的大小限制、限速及进度回调
+func (req *TargetRequest) Copy(r io.Reader, w io.Writer) (FileType, error) {
+	return req.Parser.copyStream(requestContext(req.Context), r, w)
+}
+
+// WriteOutcome 目标文件的写出结果
+type WriteOutcome string
+
+const (
+	// WriteOutcomeCreated 新建了目标文件
+	WriteOutcomeCreated WriteOutcome = "created"
+	// WriteOutcomeOverwritten 覆盖了已存在的目标文件
+	WriteOutcomeOverwritten WriteOutcome = "overwritten"
+	// WriteOutcomeSkipped 已存在内容一致的目标文件, 未写出
+	WriteOutcomeSkipped WriteOutcome = "skipped"
+	// WriteOutcomeRenamed 目标文件已存在, 写出到了重命名后的位置
+	WriteOutcomeRenamed WriteOutcome = "renamed"
+)
+
+// TargetHandler 目标文件协议处理器
+type TargetHandler interface {
+	// Write 将读取流写出到目标地址并返回文件类型
+	Write(req *TargetRequest, r io.Reader) (FileType, error)
+}
+
+// TargetHandlerFunc 函数形式的目标文件协议处理器
+type TargetHandlerFunc func(req *TargetRequest, r io.Reader) (FileType, error)
+
+// Write 实现 TargetHandler 接口
+func (f TargetHandlerFunc) Write(req *TargetRequest, r io.Reader) (FileType, error) {
+	return f(req, r)
+}
+
+// defaultSourceHandlers 内置的源文件协议处理器
+func defaultSourceHandlers() map[string]SourceHandler {
+	return map[string]SourceHandler{
+		"data":    SourceHandlerFunc(readDataSource),
+		"http":    SourceHandlerFunc(readHttpSource),
+		"https":   SourceHandlerFunc(readHttpSource),
+		"file":    SourceHandlerFunc(readFileSource),
+		"ftp":     SourceHandlerFunc(readFtpSource),
+		"sftp":    SourceHandlerFunc(readSftpSource),
+		"s3":      SourceHandlerFunc(readS3Source),
+		"webdav":  SourceHandlerFunc(readWebdavSource),
+		"webdavs": SourceHandlerFunc(readWebdavSource),
+	}
+}
+
+// defaultTargetHandlers 内置的目标文件协议处理器
+func defaultTargetHandlers() map[string]TargetHandler {
+	return map[string]TargetHandler{
+		"http":    TargetHandlerFunc(writeHttpTarget),
+		"https":   TargetHandlerFunc(writeHttpTarget),
+		"file":    TargetHandlerFunc(writeFileTarget),
+		"ftp":     TargetHandlerFunc(writeFtpTarget),
+		"sftp":    TargetHandlerFunc(writeSftpTarget),
+		"s3":      TargetHandlerFunc(writeS3Target),
+		"webdav":  TargetHandlerFunc(writeWebdavTarget),
+		"webdavs": TargetHandlerFunc(writeWebdavTarget),
+	}
+}
+
+// RegisterSource 注册源文件协议处理器, 已存在的协议将被覆盖
+func (p *Parser) RegisterSource(scheme string, handler SourceHandler) {
+	p.handlerLock.Lock()
+	defer p.handlerLock.Unlock()
+	p.sourceHandlers[strings.ToLower(scheme)] = handler
+}
+
+// RegisterTarget 注册目标文件协议处理器, 已存在的协议将被覆盖
+func (p *Parser) RegisterTarget(scheme string, handler TargetHandler) {
+	p.handlerLock.Lock()
+	defer p.handlerLock.Unlock()
+	p.targetHandlers[strings.ToLower(scheme)] = handler
+}
+
+// sourceHandler 获取源文件协议处理器
+func (p *Parser) sourceHandler(scheme string) (SourceHandler, bool) {
+	p.handlerLock.RLock()
+	defer p.handlerLock.RUnlock()
+	handler, ok := p.sourceHandlers[scheme]
+	return handler, ok
+}
+
+// targetHandler 获取目标文件协议处理器
+func (p *Parser) targetHandler(scheme string) (TargetHandler, bool) {
+	p.handlerLock.RLock()
+	defer p.handlerLock.RUnlock()
+	handler, ok := p.targetHandlers[scheme]
+	return handler, ok
+}
+
+// parseUri 解析协议地址, MIME类型的地址不做url解码
+func parseUri(uri string) (string, *url.URL, error) {
+	if uri == "" {
+		return "", nil, ErrCodeUnsupportedProtocols.Error("不支持空的地址")
+	}
+
+	if mimeTypeJudgeReg.MatchString(uri) {
+		return uri, &url.URL{Scheme: "data", Opaque: uri[len("data:"):]}, nil
+	}
+
+	uri, err := url.QueryUnescape(uri)
+	if err != nil {
+		return "", nil, ErrCodeUnsupportedProtocols.ErrorWithRawErrf(err, "解析url编码失败: %s", err.Error())
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", nil, ErrCodeUnsupportedProtocols.ErrorWithRawErrf(err, "不支持的协议类型: %s", err.Error())
+	}
+	return uri, u, nil
+}
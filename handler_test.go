@@ -0,0 +1,98 @@
+package fileaddrhandler
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestParser_RegisterHandler(t *testing.T) {
+	defer os.RemoveAll(targetFile)
+
+	a := assert.New(t)
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	parser := New(FileTypePDF)
+
+	_, err = parser.CopyByURI("dms://store/"+srcFile, "file://"+targetFile)
+	if !a.True(ErrCodeUnsupportedProtocols.Equal(err)) {
+		return
+	}
+
+	var sourceData any
+	parser.RegisterSource("DMS", SourceHandlerFunc(func(req *SourceRequest, fn func(r io.Reader) error) error {
+		sourceData = req.Data
+		if req.URL.Host != "store" || req.URL.Path != "/"+srcFile {
+			return ErrCodeProtoFileNoExist.Errorf("文档[%s]不存在", req.Uri)
+		}
+		return fn(bytes.NewReader(srcBytes))
+	}))
+
+	buf := &bytes.Buffer{}
+	parser.RegisterTarget("dms", TargetHandlerFunc(func(req *TargetRequest, r io.Reader) (FileType, error) {
+		return req.Copy(r, buf)
+	}))
+
+	_, err = parser.CopyByURI("dms://store/"+targetFile, "file://"+targetFile)
+	if !a.True(ErrCodeProtoFileNoExist.Equal(err)) {
+		return
+	}
+
+	ft, err := parser.CopyWithOption(WithAnySourceOption("token").SetUri("dms://store/"+srcFile), WithEmptyTargetOption().SetUri("dms://store/copy.pdf"))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) {
+		return
+	}
+
+	if !a.Equal("token", sourceData) {
+		return
+	}
+
+	if !a.Equal(srcBytes, buf.Bytes()) {
+		return
+	}
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetReader(bytes.NewReader([]byte("not a pdf file"))), WithEmptyTargetOption().SetUri("dms://store/copy.pdf"))
+	a.True(ErrCodeUnsupportedFileType.Equal(err))
+}
+
+func TestParser_RegisterHandlerConcurrent(t *testing.T) {
+	a := assert.New(t)
+
+	parser := New(FileTypePDF)
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			parser.RegisterSource("dms"+strconv.Itoa(i), SourceHandlerFunc(func(req *SourceRequest, fn func(r io.Reader) error) error {
+				return fn(bytes.NewReader(srcBytes))
+			}))
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, _, _ = parser.CopyToBytes("file://" + srcFile)
+		}()
+	}
+	wg.Wait()
+
+	_, _, err = parser.CopyToBytes("dms7://store/copy.pdf")
+	a.NoError(err)
+}
@@ -2,17 +2,22 @@ package fileaddrhandler
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
+	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // SourceHttpOption 原始文件的http选项
@@ -25,8 +30,36 @@ type SourceHttpOption struct {
 	Form url.Values
 	// ReqBody 请求体
 	ReqBody string
+	// Resume 读取中断时自动续传, 服务端支持 Range 时从中断位置继续, 否则重新下载并跳过已读取的内容
+	Resume bool
+	// MaxResumes 最大续传次数, 默认为3
+	MaxResumes int
+	// Segments 分段并发下载的分段数, 大于1且服务端支持 Range 时生效, 生效时不再使用 Resume
+	Segments int
+	// MinSegmentSize 每个分段的最小长度, 默认1MB, 内容较小时自动减少分段数
+	MinSegmentSize int64
+	// TLS tls选项, 为空时使用解析器的配置
+	TLS *TLSOption
+	// Client http客户端, 为空时使用解析器的客户端
+	Client *http.Client `json:"-"`
+	// Transport http传输层, 不为空时替换客户端的传输层
+	Transport http.RoundTripper `json:"-"`
+	// Retry 重试策略, 为空时使用解析器的配置
+	Retry *RetryPolicy
 }
 
+// HttpBodyMode http上传的请求体格式
+type HttpBodyMode string
+
+const (
+	// HttpBodyMultipart multipart表单上传, 默认格式
+	HttpBodyMultipart HttpBodyMode = "multipart"
+	// HttpBodyRaw 文件内容直接作为请求体, Content-Type 由识别的文件类型决定
+	HttpBodyRaw HttpBodyMode = "raw"
+	// HttpBodyBase64Json 文件内容以base64编码写入json的 FieldName 字段, Form 中的字段一并写入json
+	HttpBodyBase64Json HttpBodyMode = "base64json"
+)
+
 // TargetHttpOption 目标文件的http选项
 type TargetHttpOption struct {
 	Method    string
@@ -34,10 +67,81 @@ type TargetHttpOption struct {
 	Filename  string
 	Headers   map[string]string
 	Form      map[string]string
+	// BodyMode 请求体格式, 默认为 HttpBodyMultipart
+	BodyMode HttpBodyMode
+	// Response 不为空时写入服务端的响应内容, 需以指针形式传入选项
+	Response *HttpResponse `json:"-"`
+	// TLS tls选项, 为空时使用解析器的配置
+	TLS *TLSOption
+	// Client http客户端, 为空时使用解析器的客户端
+	Client *http.Client `json:"-"`
+	// Transport http传输层, 不为空时替换客户端的传输层
+	Transport http.RoundTripper `json:"-"`
+	// Retry 重试策略, 为空时使用解析器的配置
+	Retry *RetryPolicy
+}
+
+// TargetFileOption 目标文件的file协议选项
+type TargetFileOption struct {
+	// Overwrite 目标文件已存在时的处理策略, 默认为 OverwriteFail
+	Overwrite OverwritePolicy
+	// FileMode 文件权限, 默认为0644, 不受umask影响
+	FileMode os.FileMode
+	// DirMode 自动创建的上级目录权限, 默认为0755, 不受umask影响, 已存在的目录不修改
+	DirMode os.FileMode
+	// Uid 文件所有者, 为空时不修改, Windows下不支持
+	Uid *int
+	// Gid 文件所属组, 为空时不修改, Windows下不支持
+	Gid *int
+	// PreserveModTime 保留源文件的修改时间, 来源于本地文件属性或http响应的 Last-Modified, 源文件未提供时忽略
+	PreserveModTime bool
+}
+
+// defaultFileMode 目标文件的默认权限
+const defaultFileMode os.FileMode = 0644
+
+// defaultDirMode 自动创建的目录的默认权限
+const defaultDirMode os.FileMode = 0755
+
+// httpResponseMaxSize 记录的响应体最大长度
+const httpResponseMaxSize = 10 * 1024 * 1024
+
+// HttpResponse http上传的响应内容
+type HttpResponse struct {
+	// StatusCode 响应状态码
+	StatusCode int
+	// Header 响应头
+	Header http.Header
+	// Body 响应体
+	Body []byte
+}
+
+// JSON 将响应体解析为json
+func (h *HttpResponse) JSON(v any) error {
+	return json.Unmarshal(h.Body, v)
+}
+
+// JSONField 获取json响应体中的字段, 多级字段以.分隔, 例如 data.id
+func (h *HttpResponse) JSONField(field string) (any, bool) {
+	var v any
+	if err := h.JSON(&v); err != nil {
+		return nil, false
+	}
+
+	for _, name := range strings.Split(field, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[name]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
 }
 
 // parseOptionData 解析选项数据
-func parseOptionData[T SourceHttpOption | TargetHttpOption | []byte](d any) (res *T, err error) {
+func parseOptionData[T SourceHttpOption | TargetHttpOption | SourceFtpOption | TargetFtpOption | SourceSftpOption | TargetSftpOption | SourceS3Option | TargetS3Option | TargetWebdavOption | TargetFileOption | []byte](d any) (res *T, err error) {
 	if d == nil {
 		return nil, nil
 	}
@@ -68,6 +172,12 @@ type commonOption[T sourceOption | targetOption] struct {
 	data any
 	// raw 原始对象
 	raw *T
+	// progress 拷贝进度回调
+	progress *progressHook
+	// sizeLimit 文件大小限制
+	sizeLimit *sizeLimit
+	// rateLimiter 本次拷贝的限速器
+	rateLimiter *rateLimiter
 }
 
 // SetUri 设置uri
@@ -81,6 +191,24 @@ func (c *commonOption[T]) GetUri() string {
 	return c.uri
 }
 
+// SetProgress 设置本次拷贝的进度回调, 优先于解析器的回调, interval 小于等于0时使用默认的500毫秒
+func (c *commonOption[T]) SetProgress(fn ProgressFunc, interval time.Duration) *T {
+	c.progress = newProgressHook(fn, interval)
+	return c.raw
+}
+
+// SetSizeLimit 设置本次拷贝的文件大小限制, 优先于解析器的限制, 为0时不限制
+func (c *commonOption[T]) SetSizeLimit(min, max int64) *T {
+	c.sizeLimit = newSizeLimit(min, max)
+	return c.raw
+}
+
+// SetRateLimit 设置本次拷贝的传输速率, 与解析器的限速同时生效, bytesPerSecond 小于等于0时不限速
+func (c *commonOption[T]) SetRateLimit(bytesPerSecond, burst int64) *T {
+	c.rateLimiter = newRateLimiter(bytesPerSecond, burst)
+	return c.raw
+}
+
 // WithEmptySourceOption 空数据的option
 func WithEmptySourceOption() *sourceOption {
 	return WithAnySourceOption(nil)
@@ -91,6 +219,21 @@ func WithHttpSourceOption(option *SourceHttpOption) *sourceOption {
 	return WithAnySourceOption(option)
 }
 
+// WithFtpSourceOption ftp数据的原始请求数据
+func WithFtpSourceOption(option *SourceFtpOption) *sourceOption {
+	return WithAnySourceOption(option)
+}
+
+// WithSftpSourceOption sftp数据的原始请求数据
+func WithSftpSourceOption(option *SourceSftpOption) *sourceOption {
+	return WithAnySourceOption(option)
+}
+
+// WithS3SourceOption s3数据的原始请求数据
+func WithS3SourceOption(option *SourceS3Option) *sourceOption {
+	return WithAnySourceOption(option)
+}
+
 // WithAnySourceOption 带有任意数据的option
 func WithAnySourceOption(data any) *sourceOption {
 	option := &sourceOption{
@@ -102,14 +245,15 @@ func WithAnySourceOption(data any) *sourceOption {
 	return option
 }
 
-type readerCallback func(r io.Reader) error
+type readerCallback func(r io.Reader, size int64, modTime time.Time) error
 
 // sourceOption 源文件选项
 type sourceOption struct {
 	*commonOption[sourceOption]
 	// 文件读取流
-	r  io.Reader
-	fn readerCallback
+	r io.Reader
+	// checksum 期望的文件摘要
+	checksum *Checksum
 }
 
 // SetReader 设置原文读取流
@@ -118,7 +262,23 @@ func (s *sourceOption) SetReader(r io.Reader) *sourceOption {
 	return s
 }
 
-func (s *sourceOption) parseMimeReader(mimeStr string) error {
+// SetChecksum 设置期望的文件摘要, 拷贝完成时摘要不一致则返回 ErrCodeChecksumMismatch, 优先于json选项数据中的 Checksum 字段
+func (s *sourceOption) SetChecksum(algorithm HashAlgorithm, value string) *sourceOption {
+	s.checksum = &Checksum{Algorithm: algorithm, Value: value}
+	return s
+}
+
+// expectedChecksum 获取期望的文件摘要
+func (s *sourceOption) expectedChecksum() (*Checksum, error) {
+	if s.checksum != nil {
+		return s.checksum, nil
+	}
+	return parseChecksumOptionData(s.data)
+}
+
+// readDataSource 读取MIME类型的数据
+func readDataSource(req *SourceRequest, fn func(r io.Reader) error) error {
+	mimeStr := req.Uri
 	i := strings.Index(mimeStr, ";")
 	if i < 0 {
 		return ErrCodeUnsupportedProtocols.Error("不支持的MIME Type类型")
@@ -151,16 +311,18 @@ func (s *sourceOption) parseMimeReader(mimeStr string) error {
 		return ErrCodeUnsupportedProtocols.Errorf("解析%s格式的MIME TYPE类型内容失败: %s", t, err.Error())
 	}
 
-	return s.fn(bytes.NewReader(res))
+	req.Size = int64(len(res))
+	return fn(bytes.NewReader(res))
 }
 
-// parseHttpReader 解析HTTP头信息
-func (s *sourceOption) parseHttpReader(uri string) error {
+// readHttpSource 读取http(s)协议文件
+func readHttpSource(req *SourceRequest, fn func(r io.Reader) error) error {
 	var (
 		option *SourceHttpOption
 		err    error
+		uri    = req.Uri
 	)
-	if option, err = parseOptionData[SourceHttpOption](s.data); err != nil {
+	if option, err = parseOptionData[SourceHttpOption](req.Data); err != nil {
 		return err
 	}
 
@@ -173,25 +335,50 @@ func (s *sourceOption) parseHttpReader(uri string) error {
 		option.Method = strings.ToUpper(option.Method)
 	}
 
-	var reqBody io.Reader
-	if option.ReqBody != "" {
-		reqBody = strings.NewReader(option.ReqBody)
-	}
-
-	req, err := http.NewRequest(option.Method, uri, reqBody)
+	client, err := req.Parser.httpClientFor(option.Client, option.Transport, option.TLS)
 	if err != nil {
-		return ErrCodeHttpRequestCreate.ErrorWithRawErrf(err, "创建http请求对象失败: %s", err.Error())
+		return err
 	}
 
-	if option.Form != nil {
-		req.Form = option.Form
+	var (
+		ctx    = requestContext(req.Context)
+		policy = req.Parser.retryPolicyFor(option.Retry)
+	)
+	send := func(ctx context.Context, header http.Header) (*http.Response, error) {
+		return policy.do(ctx, func() (*http.Response, error) {
+			var reqBody io.Reader
+			if option.ReqBody != "" {
+				reqBody = strings.NewReader(option.ReqBody)
+			}
+
+			httpReq, err := http.NewRequestWithContext(ctx, option.Method, uri, reqBody)
+			if err != nil {
+				return nil, ErrCodeHttpRequestCreate.ErrorWithRawErrf(err, "创建http请求对象失败: %s", err.Error())
+			}
+
+			if option.Form != nil {
+				httpReq.Form = option.Form
+			}
+
+			if option.Headers != nil {
+				httpReq.Header = option.Headers
+			}
+
+			if len(header) > 0 {
+				httpReq.Header = httpReq.Header.Clone()
+				for k, v := range header {
+					httpReq.Header[k] = v
+				}
+			}
+			return client.Do(httpReq)
+		})
 	}
 
-	if option.Headers != nil {
-		req.Header = option.Headers
+	resp, err := send(ctx, nil)
+	if _, ok := ErrParse(err); ok {
+		return err
 	}
 
-	resp, err := httpsSupportClient.Do(req)
 	if err != nil {
 		return ErrCodeHttpRequest.ErrorWithRawErrf(err, "访问http请求资源失败: %s", err.Error())
 	}
@@ -204,54 +391,93 @@ func (s *sourceOption) parseHttpReader(uri string) error {
 		return ErrCodeResStatusCode.Errorf("非法的http响应状态码: %d", resp.StatusCode)
 	}
 
-	return s.fn(resp.Body)
-}
+	req.Size = resp.ContentLength
+	req.ModTime = responseModTime(resp)
+	if option.Segments > 1 && option.Method == http.MethodGet {
+		body, err := newSegmentedBody(ctx, resp, send, option)
+		if err != nil {
+			return err
+		}
 
-func (s *sourceOption) parse(fn readerCallback) error {
-	defer func() { s.fn = nil }()
-	s.fn = fn
-	if s.r != nil {
-		return fn(s.r)
+		if body != nil {
+			defer body.Close()
+			return fn(body)
+		}
 	}
 
-	if s.uri == "" {
-		return ErrCodeUnsupportedProtocols.Error("不支持空的地址")
+	if !option.Resume {
+		return fn(resp.Body)
 	}
 
-	if mimeTypeJudgeReg.MatchString(s.uri) {
-		return s.parseMimeReader(s.uri)
+	body := newResumableBody(ctx, resp, send, option.MaxResumes)
+	defer body.Close()
+	return fn(body)
+}
+
+// readFileSource 读取file协议文件
+func readFileSource(req *SourceRequest, fn func(r io.Reader) error) error {
+	filePath := filepath.Join(req.URL.Host, req.URL.Path)
+	if isWindows {
+		filePath = strings.TrimLeft(filePath, "/")
+		filePath = strings.TrimLeft(filePath, "\\")
 	}
 
-	uri, err := url.QueryUnescape(s.uri)
+	file, err := os.OpenFile(filePath, os.O_RDONLY, 0655)
 	if err != nil {
-		return ErrCodeUnsupportedProtocols.Error("解析url编码失败: " + err.Error())
+		return ErrCodeProtoFileOpen.ErrorWithRawErrf(err, "打开原始文件[%s]失败: %s", filePath, err.Error())
+	}
+	defer file.Close()
+
+	req.Size = readerSize(file)
+	req.ModTime = readerModTime(file)
+	return fn(file)
+}
+
+// readerModTime 获取本地文件读取流的修改时间, 未知时为零值
+func readerModTime(r io.Reader) time.Time {
+	if f, ok := r.(*os.File); ok {
+		if stat, err := f.Stat(); err == nil {
+			return stat.ModTime()
+		}
 	}
-	u, err := url.Parse(uri)
+	return time.Time{}
+}
+
+// responseModTime 获取http响应的 Last-Modified 时间, 未知时为零值
+func responseModTime(resp *http.Response) time.Time {
+	t, err := http.ParseTime(resp.Header.Get("Last-Modified"))
 	if err != nil {
-		return ErrCodeUnsupportedProtocols.ErrorWithRawErrf(err, "不支持的协议类型: %s", err.Error())
+		return time.Time{}
 	}
+	return t
+}
 
-	switch u.Scheme {
-	case "http":
-		fallthrough
-	case "https":
-		return s.parseHttpReader(uri)
-	case "file":
-		filePath := filepath.Join(u.Host, u.Path)
-		if isWindows {
-			filePath = strings.TrimLeft(filePath, "/")
-			filePath = strings.TrimLeft(filePath, "\\")
-		}
+func (s *sourceOption) parse(ctx context.Context, p *Parser, fn readerCallback) error {
+	if s.r != nil {
+		return fn(s.r, readerSize(s.r), readerModTime(s.r))
+	}
 
-		file, err := os.OpenFile(filePath, os.O_RDONLY, 0655)
-		if err != nil {
-			return ErrCodeProtoFileOpen.ErrorWithRawErrf(err, "打开原始文件[%s]失败: %s", filePath, err.Error())
-		}
-		defer file.Close()
-		return s.fn(file)
-	default:
+	uri, u, err := parseUri(s.uri)
+	if err != nil {
+		return err
+	}
+
+	handler, ok := p.sourceHandler(u.Scheme)
+	if !ok {
 		return ErrCodeUnsupportedProtocols.Error("暂不支持该协议类型")
 	}
+
+	req := &SourceRequest{
+		Uri:     uri,
+		URL:     u,
+		Data:    s.data,
+		Parser:  p,
+		Context: ctx,
+		Size:    -1,
+	}
+	return handler.Open(req, func(r io.Reader) error {
+		return fn(r, req.Size, req.ModTime)
+	})
 }
 
 // WithEmptyTargetOption 空数据的option
@@ -264,6 +490,31 @@ func WithHttpTargetOption(option *TargetHttpOption) *targetOption {
 	return WithAnyTargetOption(option)
 }
 
+// WithFtpTargetOption ftp数据的目标请求数据
+func WithFtpTargetOption(option *TargetFtpOption) *targetOption {
+	return WithAnyTargetOption(option)
+}
+
+// WithSftpTargetOption sftp数据的目标请求数据
+func WithSftpTargetOption(option *TargetSftpOption) *targetOption {
+	return WithAnyTargetOption(option)
+}
+
+// WithS3TargetOption s3数据的目标请求数据
+func WithS3TargetOption(option *TargetS3Option) *targetOption {
+	return WithAnyTargetOption(option)
+}
+
+// WithWebdavTargetOption webdav数据的目标请求数据
+func WithWebdavTargetOption(option *TargetWebdavOption) *targetOption {
+	return WithAnyTargetOption(option)
+}
+
+// WithFileTargetOption file协议的目标选项
+func WithFileTargetOption(option *TargetFileOption) *targetOption {
+	return WithAnyTargetOption(option)
+}
+
 // WithAnyTargetOption 带有任意数据的option
 func WithAnyTargetOption(data any) *targetOption {
 	option := &targetOption{
@@ -288,17 +539,32 @@ func (t *targetOption) SetWriter(w io.Writer) *targetOption {
 	return t
 }
 
+// progressPhase 写出阶段的进度类型, 写出流及本地文件为 ProgressPhaseTransfer, 其余协议为 ProgressPhaseUpload
+func (t *targetOption) progressPhase() ProgressPhase {
+	if t.w != nil {
+		return ProgressPhaseTransfer
+	}
+
+	if _, u, err := parseUri(t.uri); err == nil && u.Scheme != "file" {
+		return ProgressPhaseUpload
+	}
+	return ProgressPhaseTransfer
+}
+
 type httpFileWriteResult struct {
 	err error
 	t   FileType
 }
 
-func (t *targetOption) writeToHttp(uri string, r io.Reader, p *Parser) (FileType, error) {
+// writeHttpTarget 写出到http(s)协议地址
+func writeHttpTarget(req *TargetRequest, r io.Reader) (FileType, error) {
 	var (
 		option *TargetHttpOption
 		err    error
+		uri    = req.Uri
+		p      = req.Parser
 	)
-	if option, err = parseOptionData[TargetHttpOption](t.data); err != nil {
+	if option, err = parseOptionData[TargetHttpOption](req.Data); err != nil {
 		return "", err
 	}
 
@@ -321,9 +587,159 @@ func (t *targetOption) writeToHttp(uri string, r io.Reader, p *Parser) (FileType
 		option.Filename = uri[i+1:]
 	}
 
+	client, err := p.httpClientFor(option.Client, option.Transport, option.TLS)
+	if err != nil {
+		return "", err
+	}
+
+	policy := p.retryPolicyFor(option.Retry)
+	var replay *replayReader
+	if policy != nil && policy.MaxAttempts > 1 {
+		replay = newReplayReader(r)
+		defer replay.Close()
+	}
+
+	var (
+		body io.Reader
+		ch   <-chan *httpFileWriteResult
+		ctx  = requestContext(req.Context)
+	)
+	res, err := policy.do(ctx, func() (*http.Response, error) {
+		if body != nil {
+			// 结束上一次请求的写出协程后才能重放读取流
+			closeHttpBody(body, io.ErrClosedPipe)
+			<-ch
+			body = nil
+		}
+
+		src := r
+		if replay != nil {
+			var err error
+			if src, err = replay.reader(); err != nil {
+				return nil, ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "重放源文件内容失败: %s", err.Error())
+			}
+		}
+
+		var (
+			contentType string
+			err         error
+		)
+		if body, contentType, ch, err = httpTargetBody(option, src, p); err != nil {
+			return nil, err
+		}
+
+		httpReq, err := http.NewRequestWithContext(ctx, option.Method, uri, body)
+		if err != nil {
+			return nil, ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "创建请求对象失败: %s", err.Error())
+		}
+
+		if len(option.Headers) > 0 {
+			for k := range option.Headers {
+				v := option.Headers[k]
+				httpReq.Header.Add(k, v)
+			}
+		}
+
+		if httpReq.Header.Get("Content-Type") == "" {
+			httpReq.Header.Set("Content-Type", contentType)
+		}
+		return client.Do(httpReq)
+	})
+	if err != nil {
+		closeHttpBody(body, err)
+		if body != nil {
+			// 写出协程因文件大小或摘要校验失败中断请求时, 返回其原始错误
+			if result := <-ch; result != nil && (ErrCodeFileSize.Equal(result.err) || ErrCodeChecksumMismatch.Equal(result.err)) {
+				return "", result.err
+			}
+		}
+
+		if _, ok := ErrParse(err); ok {
+			return "", err
+		}
+		return "", ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "向目标请求发送数据失败: %s", err.Error())
+	}
+	defer res.Body.Close()
+
+	if option.Response != nil {
+		resBody, err := ioutil.ReadAll(io.LimitReader(res.Body, httpResponseMaxSize))
+		if err != nil {
+			closeHttpBody(body, err)
+			return "", ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "读取服务器响应失败: %s", err.Error())
+		}
+		*option.Response = HttpResponse{
+			StatusCode: res.StatusCode,
+			Header:     res.Header,
+			Body:       resBody,
+		}
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		closeHttpBody(body, io.ErrClosedPipe)
+		return "", ErrCodeTargetFileWrite.Errorf("服务器返回错误的状态码: %d", res.StatusCode)
+	}
+
+	result := <-ch
+	return result.t, result.err
+}
+
+// httpTargetBody 按请求体格式构建管道形式的请求体, 文件内容由写出协程写入, 结果通过返回的通道获取
+func httpTargetBody(option *TargetHttpOption, r io.Reader, p *Parser) (io.Reader, string, <-chan *httpFileWriteResult, error) {
+	ch := make(chan *httpFileWriteResult, 1)
+	switch option.BodyMode {
+	case "", HttpBodyMultipart:
+		body, contentType := multipartHttpBody(option, r, p, ch)
+		return body, contentType, ch, nil
+	case HttpBodyRaw, HttpBodyBase64Json:
+		fileType, src, err := p.detectFileType(r)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		if option.BodyMode == HttpBodyRaw {
+			return rawHttpBody(fileType, src, ch), fileType.MimeType(), ch, nil
+		}
+		body, contentType := base64JsonHttpBody(option, fileType, src, ch)
+		return body, contentType, ch, nil
+	default:
+		return nil, "", nil, ErrOption.Errorf("不支持的请求体格式: %s", option.BodyMode)
+	}
+}
+
+// rawHttpBody 构建文件内容直接作为请求体的管道
+func rawHttpBody(fileType FileType, src io.Reader, ch chan<- *httpFileWriteResult) io.Reader {
+	pipeR, pipeW := io.Pipe()
+	go func() {
+		_, err := io.Copy(pipeW, src)
+		_ = pipeW.CloseWithError(err)
+		if err != nil {
+			ch <- &httpFileWriteResult{err: httpBodyWriteError(err)}
+			return
+		}
+		ch <- &httpFileWriteResult{t: fileType}
+	}()
+	return pipeR
+}
+
+// httpBodyWriteError 包装请求体写出协程的错误, 文件大小及摘要校验错误原样返回
+func httpBodyWriteError(err error) error {
+	if ErrCodeFileSize.Equal(err) || ErrCodeChecksumMismatch.Equal(err) {
+		return err
+	}
+	return ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "向目标文件写出内容失败: %s", err.Error())
+}
+
+// closeHttpBody 请求失败时关闭管道形式的请求体, 结束写出协程
+func closeHttpBody(body io.Reader, err error) {
+	if pipeR, ok := body.(*io.PipeReader); ok {
+		_ = pipeR.CloseWithError(err)
+	}
+}
+
+// multipartHttpBody 构建multipart表单格式的请求体
+func multipartHttpBody(option *TargetHttpOption, r io.Reader, p *Parser, ch chan<- *httpFileWriteResult) (io.Reader, string) {
 	pipeR, pipeW := io.Pipe()
 	m := multipart.NewWriter(pipeW)
-	ch := make(chan *httpFileWriteResult, 1)
 	go func() {
 		defer pipeW.Close()
 		defer m.Close()
@@ -334,7 +750,7 @@ func (t *targetOption) writeToHttp(uri string, r io.Reader, p *Parser) (FileType
 			ch <- &httpFileWriteResult{err: err}
 			return
 		}
-		fileType, err := p.Copy(r, f)
+		fileType, err := p.copyStream(context.Background(), r, f)
 
 		if option.Form != nil {
 			for k, v := range option.Form {
@@ -347,86 +763,279 @@ func (t *targetOption) writeToHttp(uri string, r io.Reader, p *Parser) (FileType
 
 		ch <- &httpFileWriteResult{err: err, t: fileType}
 	}()
+	return pipeR, m.FormDataContentType()
+}
+
+// base64JsonHttpBody 构建文件内容base64编码后写入json字段的请求体
+func base64JsonHttpBody(option *TargetHttpOption, fileType FileType, src io.Reader, ch chan<- *httpFileWriteResult) (io.Reader, string) {
+	pipeR, pipeW := io.Pipe()
+	go func() {
+		err := func() error {
+			if _, err := io.WriteString(pipeW, "{"); err != nil {
+				return err
+			}
+
+			for k, v := range option.Form {
+				field, _ := json.Marshal(k)
+				value, _ := json.Marshal(v)
+				if _, err := fmt.Fprintf(pipeW, "%s:%s,", field, value); err != nil {
+					return err
+				}
+			}
 
-	req, err := http.NewRequest(option.Method, uri, pipeR)
+			field, _ := json.Marshal(option.FieldName)
+			if _, err := fmt.Fprintf(pipeW, "%s:\"", field); err != nil {
+				return err
+			}
+
+			enc := base64.NewEncoder(base64.StdEncoding, pipeW)
+			if _, err := io.Copy(enc, src); err != nil {
+				return err
+			}
+			if err := enc.Close(); err != nil {
+				return err
+			}
+
+			_, err := io.WriteString(pipeW, "\"}")
+			return err
+		}()
+
+		_ = pipeW.CloseWithError(err)
+		if err != nil {
+			ch <- &httpFileWriteResult{err: httpBodyWriteError(err)}
+			return
+		}
+		ch <- &httpFileWriteResult{t: fileType}
+	}()
+	return pipeR, "application/json"
+}
+
+// writeFileTarget 写出到file协议地址
+func writeFileTarget(req *TargetRequest, r io.Reader) (FileType, error) {
+	option, err := parseOptionData[TargetFileOption](req.Data)
 	if err != nil {
-		return "", ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "创建请求对象失败: %s", err.Error())
+		return "", err
+	}
+
+	if option == nil {
+		option = &TargetFileOption{}
 	}
 
-	if len(option.Headers) > 0 {
-		for k := range option.Headers {
-			v := option.Headers[k]
-			req.Header.Add(k, v)
+	fp := filepath.Join(req.URL.Host, req.URL.Path)
+	if isWindows {
+		fp = strings.TrimLeft(fp, "/")
+		fp = strings.TrimLeft(fp, "\\")
+	}
+
+	policy := option.Overwrite
+	switch policy {
+	case "":
+		policy = OverwriteFail
+	case OverwriteFail, OverwriteReplace, OverwriteSkipIdentical, OverwriteRename, OverwriteTimestamp:
+	default:
+		return "", ErrOption.Errorf("不支持的覆盖策略[%s]", policy)
+	}
+
+	exists := false
+	if stat, err := os.Stat(fp); err == nil {
+		if stat.IsDir() {
+			return "", ErrCodeFileExists.Errorf("目标地址[%s]不能是一个目录", fp)
 		}
+		exists = true
+	}
+
+	if exists && policy == OverwriteFail {
+		return "", ErrCodeFileExists.Errorf("文件[%s]已存在", fp)
 	}
 
-	req.Header.Add("Content-Type", m.FormDataContentType())
+	var digest hash.Hash
+	if exists && policy == OverwriteSkipIdentical {
+		digest = sha256.New()
+	}
 
-	res, err := httpsSupportClient.Do(req)
+	dirMode := option.DirMode
+	if dirMode == 0 {
+		dirMode = defaultDirMode
+	}
+
+	if err = mkdirAllMode(filepath.Dir(fp), dirMode); err != nil {
+		return "", ErrCodeMkdir.ErrorWithRawErrf(err, "创建目标目录[%s]失败: %s", filepath.Dir(fp), err.Error())
+	}
+
+	var modTime time.Time
+	if option.PreserveModTime {
+		modTime = req.ModTime
+	}
+
+	tmpPath, ft, err := writeTempFile(fp, option, modTime, func(w io.Writer) (FileType, error) {
+		if digest != nil {
+			w = io.MultiWriter(w, digest)
+		}
+		return req.Copy(r, w)
+	})
 	if err != nil {
-		return "", ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "向目标请求发送数据失败: %s", err.Error())
+		return "", err
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode < 200 || res.StatusCode > 299 {
-		return "", ErrCodeTargetFileWrite.Errorf("服务器返回错误的状态码: %d", res.StatusCode)
+	req.Location, req.Outcome = fp, WriteOutcomeCreated
+	switch policy {
+	case OverwriteFail, OverwriteRename, OverwriteTimestamp:
+		// 不覆盖的策略以硬链接放置临时文件, 拷贝期间出现的同名文件不会被替换
+		if exists {
+			req.Location, req.Outcome = availableFilePath(fp, policy), WriteOutcomeRenamed
+		}
+
+		for {
+			placed, err := linkNewFile(tmpPath, req.Location, option)
+			if err != nil {
+				_ = os.Remove(tmpPath)
+				return "", ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "放置目标文件失败: %s", err.Error())
+			}
+
+			if placed {
+				return ft, nil
+			}
+
+			if policy == OverwriteFail {
+				_ = os.Remove(tmpPath)
+				return "", ErrCodeFileExists.Errorf("文件[%s]已存在", fp)
+			}
+			req.Location, req.Outcome = availableFilePath(fp, policy), WriteOutcomeRenamed
+		}
+	case OverwriteSkipIdentical:
+		if exists {
+			if sameFileContent(fp, tmpPath, digest.Sum(nil)) {
+				_ = os.Remove(tmpPath)
+				req.Outcome = WriteOutcomeSkipped
+				return ft, nil
+			}
+			req.Outcome = WriteOutcomeOverwritten
+		}
+	default:
+		if exists {
+			req.Outcome = WriteOutcomeOverwritten
+		}
 	}
 
-	result := <-ch
-	return result.t, result.err
+	if err = os.Rename(tmpPath, req.Location); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "重命名目标文件失败: %s", err.Error())
+	}
+	return ft, nil
 }
 
-func (t *targetOption) writeByReader(r io.Reader, p *Parser) (FileType, error) {
-	if t.w != nil {
-		return p.Copy(r, t.w)
+// mkdirAllMode 逐级创建目录, 新创建的目录显式设置权限, 避免受umask影响
+func mkdirAllMode(dir string, mode os.FileMode) error {
+	var created []string
+	for p := dir; !fileExists(p); p = filepath.Dir(p) {
+		created = append(created, p)
+		if parent := filepath.Dir(p); parent == p {
+			break
+		}
 	}
 
-	if t.uri == "" {
-		return "", ErrCodeUnsupportedProtocols.Error("不支持空的地址")
+	if err := os.MkdirAll(dir, mode); err != nil {
+		return err
 	}
 
-	if mimeTypeJudgeReg.MatchString(t.uri) {
-		return "", ErrCodeUnsupportedProtocols.Error("不支持写出MIME类型数据")
+	for _, p := range created {
+		if err := os.Chmod(p, mode); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	uri, err := url.QueryUnescape(t.uri)
+// writeTempFile 写入目标文件同目录下的临时文件, 设置权限、所有者及修改时间并同步落盘, 返回临时文件路径, 任意步骤失败时删除临时文件, 不会留下不完整的目标文件
+func writeTempFile(fp string, option *TargetFileOption, modTime time.Time, fn func(w io.Writer) (FileType, error)) (tmpPath string, ft FileType, err error) {
+	file, err := os.CreateTemp(filepath.Dir(fp), "."+filepath.Base(fp)+".*.tmp")
 	if err != nil {
-		return "", ErrCodeUnsupportedProtocols.Error("解析写出url编码失败: " + err.Error())
+		return "", "", ErrCodeProtoFileOpen.ErrorWithRawErrf(err, "创建目标文件失败: %s", err.Error())
 	}
-	u, err := url.Parse(uri)
-	if err != nil {
-		return "", ErrCodeUnsupportedProtocols.ErrorWithRawErrf(err, "不支持的写出协议类型: %s", err.Error())
-	}
-
-	switch u.Scheme {
-	case "http":
-		fallthrough
-	case "https":
-		return t.writeToHttp(uri, r, p)
-	case "file":
-		fp := filepath.Join(u.Host, u.Path)
-		if isWindows {
-			fp = strings.TrimLeft(fp, "/")
-			fp = strings.TrimLeft(fp, "\\")
-		}
-
-		stat, err := os.Stat(fp)
-		if err == nil {
-			if stat.IsDir() {
-				return "", fmt.Errorf("目标地址[%s]不能是一个目录", fp)
-			} else {
-				return "", fmt.Errorf("文件[%s]已存在", fp)
-			}
-		}
 
-		_ = os.MkdirAll(filepath.Dir(fp), 0755)
-		file, err := os.OpenFile(fp, os.O_WRONLY|os.O_CREATE, 0655)
+	name := file.Name()
+	defer func() {
 		if err != nil {
-			return "", ErrCodeProtoFileOpen.ErrorWithRawErrf(err, "创建目标文件失败: %s", err.Error())
+			_ = file.Close()
+			_ = os.Remove(name)
 		}
-		defer file.Close()
-		return p.Copy(r, file)
-	default:
-		return "", ErrCodeUnsupportedProtocols.Error("暂不支持该写出协议类型")
+	}()
+
+	if ft, err = fn(file); err != nil {
+		return "", "", err
+	}
+
+	mode := option.FileMode
+	if mode == 0 {
+		mode = defaultFileMode
+	}
+
+	if err = file.Chmod(mode); err != nil {
+		return "", "", ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "设置目标文件权限失败: %s", err.Error())
+	}
+
+	if err = chownFile(file, option); err != nil {
+		return "", "", ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "设置目标文件所有者失败: %s", err.Error())
+	}
+
+	if err = file.Sync(); err != nil {
+		return "", "", ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "目标文件同步落盘失败: %s", err.Error())
+	}
+
+	if err = file.Close(); err != nil {
+		return "", "", ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "关闭目标文件失败: %s", err.Error())
+	}
+
+	if !modTime.IsZero() {
+		if err = os.Chtimes(name, modTime, modTime); err != nil {
+			return "", "", ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "设置目标文件修改时间失败: %s", err.Error())
+		}
+	}
+	return name, ft, nil
+}
+
+// chownFile 按选项设置文件的所有者, 未设置时保持不变
+func chownFile(file *os.File, option *TargetFileOption) error {
+	if option.Uid == nil && option.Gid == nil {
+		return nil
+	}
+
+	uid, gid := -1, -1
+	if option.Uid != nil {
+		uid = *option.Uid
+	}
+
+	if option.Gid != nil {
+		gid = *option.Gid
+	}
+	return file.Chown(uid, gid)
+}
+
+// writeByReader 写出到目标, 返回的目标请求携带处理器设置的写出位置及结果, 目标为写出流时为nil
+func (t *targetOption) writeByReader(ctx context.Context, r io.Reader, p *Parser, modTime time.Time) (FileType, *TargetRequest, error) {
+	if t.w != nil {
+		ft, err := p.copyStream(ctx, r, t.w)
+		return ft, nil, err
+	}
+
+	uri, u, err := parseUri(t.uri)
+	if err != nil {
+		return "", nil, err
+	}
+
+	handler, ok := p.targetHandler(u.Scheme)
+	if !ok {
+		return "", nil, ErrCodeUnsupportedProtocols.Error("暂不支持该写出协议类型")
+	}
+
+	req := &TargetRequest{
+		Uri:     uri,
+		URL:     u,
+		Data:    t.data,
+		Parser:  p,
+		Context: ctx,
+		ModTime: modTime,
 	}
+	ft, err := handler.Write(req, r)
+	return ft, req, err
 }
@@ -0,0 +1,150 @@
+package fileaddrhandler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OverwritePolicy 目标文件已存在时的处理策略
+type OverwritePolicy string
+
+const (
+	// OverwriteFail 返回 ErrCodeFileExists, 默认策略
+	OverwriteFail OverwritePolicy = "fail"
+	// OverwriteReplace 覆盖已存在的文件
+	OverwriteReplace OverwritePolicy = "overwrite"
+	// OverwriteSkipIdentical 大小及SHA-256摘要一致时跳过写出, 否则覆盖
+	OverwriteSkipIdentical OverwritePolicy = "skipIdentical"
+	// OverwriteRename 在文件名后追加数字后缀, 例如 a_1.pdf
+	OverwriteRename OverwritePolicy = "rename"
+	// OverwriteTimestamp 在文件名后追加时间戳, 例如 a_20060102150405.pdf, 仍冲突时再追加数字后缀
+	OverwriteTimestamp OverwritePolicy = "timestamp"
+)
+
+// availableFilePath 按策略生成不存在的文件路径
+func availableFilePath(fp string, policy OverwritePolicy) string {
+	ext := filepath.Ext(fp)
+	base := strings.TrimSuffix(fp, ext)
+
+	if policy == OverwriteTimestamp {
+		base += "_" + time.Now().Format("20060102150405")
+		if p := base + ext; !fileExists(p) {
+			return p
+		}
+	}
+
+	for i := 1; ; i++ {
+		if p := base + "_" + strconv.Itoa(i) + ext; !fileExists(p) {
+			return p
+		}
+	}
+}
+
+// linkFile 创建硬链接, 测试时替换以模拟不支持硬链接的文件系统
+var linkFile = os.Link
+
+// linkNewFile 以硬链接方式将临时文件放置到指定路径并删除临时文件, 文件系统不支持硬链接时改为独占创建并拷贝, 路径已存在时返回false且保留临时文件
+func linkNewFile(tmpPath, fp string, option *TargetFileOption) (bool, error) {
+	if err := linkFile(tmpPath, fp); err != nil {
+		if os.IsExist(err) {
+			return false, nil
+		}
+		return copyNewFile(tmpPath, fp, option)
+	}
+	_ = os.Remove(tmpPath)
+	return true, nil
+}
+
+// copyNewFile 以独占创建的方式将临时文件拷贝到指定路径并删除临时文件, 保留权限、所有者及修改时间, 路径已存在时返回false且保留临时文件
+func copyNewFile(tmpPath, fp string, option *TargetFileOption) (placed bool, err error) {
+	src, err := os.Open(tmpPath)
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+
+	stat, err := src.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	dst, err := os.OpenFile(fp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, stat.Mode().Perm())
+	if err != nil {
+		if os.IsExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = dst.Close()
+			_ = os.Remove(fp)
+		}
+	}()
+
+	if _, err = io.Copy(dst, src); err != nil {
+		return false, err
+	}
+
+	if err = dst.Chmod(stat.Mode()); err != nil {
+		return false, err
+	}
+
+	if err = chownFile(dst, option); err != nil {
+		return false, err
+	}
+
+	if err = dst.Sync(); err != nil {
+		return false, err
+	}
+
+	if err = dst.Close(); err != nil {
+		return false, err
+	}
+
+	if err = os.Chtimes(fp, stat.ModTime(), stat.ModTime()); err != nil {
+		return false, err
+	}
+
+	_ = src.Close()
+	_ = os.Remove(tmpPath)
+	return true, nil
+}
+
+// fileExists 判断路径是否存在
+func fileExists(p string) bool {
+	_, err := os.Lstat(p)
+	return err == nil || !os.IsNotExist(err)
+}
+
+// sameFileContent 判断已存在文件与新写出的文件大小及摘要是否一致
+func sameFileContent(existPath, newPath string, newSum []byte) bool {
+	existStat, err := os.Stat(existPath)
+	if err != nil {
+		return false
+	}
+
+	newStat, err := os.Stat(newPath)
+	if err != nil || existStat.Size() != newStat.Size() {
+		return false
+	}
+
+	f, err := os.Open(existPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return false
+	}
+	return bytes.Equal(h.Sum(nil), newSum)
+}
@@ -0,0 +1,229 @@
+package fileaddrhandler
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestParser_OverwritePolicy(t *testing.T) {
+	a := assert.New(t)
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	dir := t.TempDir()
+	targetPath := filepath.Join(dir, "policy.pdf")
+	parser := New(FileTypePDF)
+
+	copyWith := func(data []byte, option any) (*CopyResult, error) {
+		return parser.CopyWithResult(WithEmptySourceOption().SetReader(bytes.NewReader(data)), WithAnyTargetOption(option).SetUri("file://"+targetPath))
+	}
+
+	res, err := copyWith(srcBytes, nil)
+	if !a.NoError(err) || !a.Equal(WriteOutcomeCreated, res.Outcome) || !a.Equal(targetPath, res.Location) {
+		return
+	}
+
+	_, err = copyWith(srcBytes, nil)
+	if !a.True(ErrCodeFileExists.Equal(err)) {
+		return
+	}
+
+	_, err = copyWith(srcBytes, &TargetFileOption{Overwrite: "unknown"})
+	if !a.True(ErrOption.Equal(err)) {
+		return
+	}
+
+	res, err = copyWith(srcBytes, `{"Overwrite":"skipIdentical"}`)
+	if !a.NoError(err) || !a.Equal(WriteOutcomeSkipped, res.Outcome) || !a.Equal(FileTypePDF, res.FileType) {
+		return
+	}
+
+	changed := srcBytes[:len(srcBytes)/2]
+	res, err = copyWith(changed, &TargetFileOption{Overwrite: OverwriteSkipIdentical})
+	if !a.NoError(err) || !a.Equal(WriteOutcomeOverwritten, res.Outcome) {
+		return
+	}
+
+	targetBytes, err := ioutil.ReadFile(targetPath)
+	if !a.NoError(err) || !a.Equal(changed, targetBytes) {
+		return
+	}
+
+	res, err = copyWith(srcBytes, TargetFileOption{Overwrite: OverwriteReplace})
+	if !a.NoError(err) || !a.Equal(WriteOutcomeOverwritten, res.Outcome) {
+		return
+	}
+
+	targetBytes, err = ioutil.ReadFile(targetPath)
+	if !a.NoError(err) || !a.Equal(srcBytes, targetBytes) {
+		return
+	}
+
+	for i, expected := range []string{"policy_1.pdf", "policy_2.pdf"} {
+		res, err = copyWith(srcBytes, &TargetFileOption{Overwrite: OverwriteRename})
+		if !a.NoError(err, i) || !a.Equal(WriteOutcomeRenamed, res.Outcome) || !a.Equal(filepath.Join(dir, expected), res.Location) {
+			return
+		}
+	}
+
+	res, err = copyWith(srcBytes, &TargetFileOption{Overwrite: OverwriteTimestamp})
+	if !a.NoError(err) || !a.Equal(WriteOutcomeRenamed, res.Outcome) {
+		return
+	}
+
+	name := filepath.Base(res.Location)
+	if !a.True(strings.HasPrefix(name, "policy_") && strings.HasSuffix(name, ".pdf") && len(name) == len("policy_20060102150405.pdf"), name) {
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if !a.NoError(err) {
+		return
+	}
+	a.Len(entries, 4)
+}
+
+// testCreateOnEOFReader 读取结束时创建指定文件, 模拟拷贝期间出现的同名文件
+type testCreateOnEOFReader struct {
+	r    io.Reader
+	path string
+	data []byte
+}
+
+func (c *testCreateOnEOFReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err == io.EOF && c.path != "" {
+		if werr := ioutil.WriteFile(c.path, c.data, 0644); werr != nil {
+			return n, werr
+		}
+		c.path = ""
+	}
+	return n, err
+}
+
+func TestParser_OverwriteConcurrentCreate(t *testing.T) {
+	a := assert.New(t)
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	dir := t.TempDir()
+	targetPath := filepath.Join(dir, "race.pdf")
+	other := []byte("created during copy")
+	parser := New(FileTypePDF)
+
+	copyWith := func(policy OverwritePolicy) (*CopyResult, error) {
+		src := &testCreateOnEOFReader{r: bytes.NewReader(srcBytes), path: targetPath, data: other}
+		return parser.CopyWithResult(WithEmptySourceOption().SetReader(src),
+			WithFileTargetOption(&TargetFileOption{Overwrite: policy}).SetUri("file://"+targetPath))
+	}
+
+	_, err = copyWith(OverwriteFail)
+	if !a.True(ErrCodeFileExists.Equal(err)) {
+		return
+	}
+
+	targetBytes, err := ioutil.ReadFile(targetPath)
+	if !a.NoError(err) || !a.Equal(other, targetBytes) {
+		return
+	}
+
+	for _, policy := range []OverwritePolicy{OverwriteRename, OverwriteTimestamp} {
+		if !a.NoError(os.Remove(targetPath)) {
+			return
+		}
+
+		res, err := copyWith(policy)
+		if !a.NoError(err, policy) || !a.Equal(WriteOutcomeRenamed, res.Outcome) || !a.NotEqual(targetPath, res.Location) {
+			return
+		}
+
+		targetBytes, err = ioutil.ReadFile(targetPath)
+		if !a.NoError(err) || !a.Equal(other, targetBytes) {
+			return
+		}
+
+		targetBytes, err = ioutil.ReadFile(res.Location)
+		if !a.NoError(err) || !a.Equal(srcBytes, targetBytes) {
+			return
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if !a.NoError(err) {
+		return
+	}
+	a.Len(entries, 3)
+}
+
+func TestParser_OverwriteWithoutHardLink(t *testing.T) {
+	a := assert.New(t)
+
+	// 模拟不支持硬链接的文件系统
+	linkFile = func(oldname, newname string) error {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EPERM}
+	}
+	defer func() { linkFile = os.Link }()
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	srcStat, err := os.Stat(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	dir := t.TempDir()
+	targetPath := filepath.Join(dir, "nolink.pdf")
+	parser := New(FileTypePDF)
+
+	copyWith := func(policy OverwritePolicy) (*CopyResult, error) {
+		return parser.CopyWithResult(WithEmptySourceOption().SetUri("file://"+srcFile),
+			WithFileTargetOption(&TargetFileOption{Overwrite: policy, FileMode: 0600, PreserveModTime: true}).SetUri("file://"+targetPath))
+	}
+
+	res, err := copyWith(OverwriteFail)
+	if !a.NoError(err) || !a.Equal(WriteOutcomeCreated, res.Outcome) {
+		return
+	}
+
+	targetBytes, err := ioutil.ReadFile(targetPath)
+	if !a.NoError(err) || !a.Equal(srcBytes, targetBytes) {
+		return
+	}
+
+	stat, err := os.Stat(targetPath)
+	if !a.NoError(err) || !a.Equal(os.FileMode(0600), stat.Mode().Perm()) || !a.True(srcStat.ModTime().Equal(stat.ModTime())) {
+		return
+	}
+
+	_, err = copyWith(OverwriteFail)
+	if !a.True(ErrCodeFileExists.Equal(err)) {
+		return
+	}
+
+	res, err = copyWith(OverwriteRename)
+	if !a.NoError(err) || !a.Equal(WriteOutcomeRenamed, res.Outcome) || !a.Equal(filepath.Join(dir, "nolink_1.pdf"), res.Location) {
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if !a.NoError(err) {
+		return
+	}
+	a.Len(entries, 2)
+}
@@ -2,23 +2,19 @@ package fileaddrhandler
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/base64"
 	"encoding/hex"
 	"io"
 	"net/http"
-	"os"
 	"regexp"
 	"runtime"
-	"strings"
+	"sync"
+	"time"
 )
 
 const isWindows = runtime.GOOS == "windows"
 
-var httpsSupportClient = &http.Client{Transport: &http.Transport{
-	TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-}}
-
 var (
 	// mimeTypeJudgeReg MIME类型判断正则
 	mimeTypeJudgeReg = regexp.MustCompile("^data:([a-z]+)/([a-z]+);base64,([\\da-zA-Z+=/]+)$")
@@ -35,6 +31,28 @@ const (
 type Parser struct {
 	// SupportFileTypes 支持的类型列表
 	supportFileTypeMap map[FileType]struct{}
+	// sourceHandlers 源文件协议处理器
+	sourceHandlers map[string]SourceHandler
+	// targetHandlers 目标文件协议处理器
+	targetHandlers map[string]TargetHandler
+	// handlerLock 协议处理器注册表锁
+	handlerLock sync.RWMutex
+	// tlsTransports 选项中tls配置对应的传输层缓存
+	tlsTransports map[tlsTransportKey]*tlsTransportEntry
+	// tlsTransportKeys tls传输层缓存的键, 按加入顺序排列
+	tlsTransportKeys []tlsTransportKey
+	// tlsLock tls传输层缓存锁
+	tlsLock sync.Mutex
+	// httpClient http(s)请求使用的客户端
+	httpClient *http.Client
+	// retry 远程请求的重试策略
+	retry *RetryPolicy
+	// progress 拷贝进度回调
+	progress *progressHook
+	// sizeLimit 文件大小限制
+	sizeLimit *sizeLimit
+	// rateLimiter 所有拷贝共享的限速器
+	rateLimiter *rateLimiter
 }
 
 // New 初始化解析器对象
@@ -45,7 +63,61 @@ func New(supportTypes ...FileType) *Parser {
 	}
 	return &Parser{
 		supportFileTypeMap: supportMap,
+		sourceHandlers:     defaultSourceHandlers(),
+		targetHandlers:     defaultTargetHandlers(),
+		httpClient:         &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()},
+	}
+}
+
+// SetTLSOption 设置https请求的tls选项, 默认校验服务端证书
+func (p *Parser) SetTLSOption(option *TLSOption) error {
+	client, err := newTLSHttpClient(p.httpClient, option)
+	if err != nil {
+		return err
+	}
+	p.httpClient = client
+	return nil
+}
+
+// SetHttpClient 设置http(s)请求使用的客户端, 为空时恢复默认客户端
+func (p *Parser) SetHttpClient(client *http.Client) {
+	if client == nil {
+		client = &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}
 	}
+	p.httpClient = client
+}
+
+// SetRoundTripper 设置http(s)请求使用的传输层, 保留客户端的其余配置
+func (p *Parser) SetRoundTripper(transport http.RoundTripper) {
+	client := *p.httpClient
+	client.Transport = transport
+	p.httpClient = &client
+}
+
+// HttpClient 获取http(s)请求使用的客户端
+func (p *Parser) HttpClient() *http.Client {
+	return p.httpClient
+}
+
+// httpClientFor 获取单次操作使用的客户端, 优先级: 选项客户端 > 解析器客户端, 选项中的传输层及tls配置在此基础上覆盖, 未关联解析器时使用默认客户端
+func (p *Parser) httpClientFor(client *http.Client, transport http.RoundTripper, option *TLSOption) (*http.Client, error) {
+	if client == nil {
+		client = http.DefaultClient
+		if p != nil {
+			client = p.httpClient
+		}
+	}
+
+	if transport != nil {
+		c := *client
+		c.Transport = transport
+		client = &c
+	}
+
+	if option == nil {
+		return client, nil
+	}
+	return p.tlsHttpClient(client, option)
 }
 
 // AddSupportTypes 添加支持的类型
@@ -65,98 +137,97 @@ func (p *Parser) DelSupportTypes(fts ...FileType) {
 	}
 }
 
-// writeSupportFile 向目标写入支持的文件
-func (p *Parser) writeSupportFile(src io.Reader, target io.Writer) (FileType, error) {
-	buf := make([]byte, 10)
-	n, err := src.Read(buf)
-	if err != nil {
-		return "", ErrCodeProtoFileRead.ErrorWithRawErrf(err, "协议文件内容读取失败: %s", err.Error())
-	}
-
-	buf = buf[:n]
-	rawHeadHex := byteToHex(buf)
-
-	ft := FileEmpty
+// headerSize 识别支持的文件类型需要读取的文件头长度
+func (p *Parser) headerSize() int {
+	size := fileHeaderSize
 	for k := range p.supportFileTypeMap {
-		if k.Is(rawHeadHex) {
-			ft = k
-			goto StartCopy
+		if n := k.headerSize(); n > size {
+			size = n
 		}
 	}
-	return "", ErrCodeUnsupportedFileType.Error("不支持当前原始的文件类型")
-StartCopy:
-	if _, err = target.Write(buf); err != nil {
-		return "", ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "向目标文件写出内容失败: %s", err)
-	}
+	return size
+}
 
-	if _, err = io.Copy(target, src); err != nil {
-		return "", ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "向目标文件写出内容失败: %s.", err)
+// detectFileType 读取文件头并识别文件类型, 多个类型同时匹配时取魔数最具体的类型, 返回的读取流会重新携带已读取的文件头
+func (p *Parser) detectFileType(src io.Reader) (FileType, io.Reader, error) {
+	buf := make([]byte, p.headerSize())
+	n, err := io.ReadFull(src, buf)
+	if err == io.ErrUnexpectedEOF {
+		// 文件长度小于文件头长度, 按已读取的内容识别
+		err = nil
 	}
 
-	return ft, nil
-}
+	if ErrCodeFileSize.Equal(err) || ErrCodeChecksumMismatch.Equal(err) {
+		return "", nil, err
+	}
 
-// mimeFileWrite mime类型文件写出
-func (p *Parser) mimeFileWrite(mimeStr string, w io.Writer) (FileType, error) {
-	index := strings.Index(mimeStr, "base64,")
-	if index == -1 {
-		return "", ErrCodeUnsupportedProtocols.Errorf("非法的协议地址[%s]", mimeStr)
+	if err == io.EOF {
+		return "", nil, ErrCodeEmptyFile.Error("源文件内容为空")
 	}
-	b64Data := mimeStr[index+7:]
-	dataBytes, err := base64.StdEncoding.DecodeString(b64Data)
+
 	if err != nil {
-		return "", ErrCodeProtoFileOpen.ErrorWithRawErrf(err, "协议文件格式解析失败: %s", err.Error())
+		return "", nil, ErrCodeProtoFileRead.ErrorWithRawErrf(err, "协议文件内容读取失败: %s", err.Error())
 	}
-	return p.writeSupportFile(bytes.NewReader(dataBytes), w)
-}
 
-// httpProtoWrite http协议文件写出
-// 支持http(s)协议类型, 暂时只支持Get 无参请求, 示例类型如下
-// http://127.0.0.1/1.pdf
-// https://127.0.0.1/1.pdf
-func (p *Parser) httpProtoWrite(uri string, w io.Writer) (FileType, error) {
-	req, err := http.NewRequest("GET", uri, nil)
-	if err != nil {
-		return "", ErrCodeHttpRequestCreate.ErrorWithRawErrf(err, "创建http请求对象失败: %s", err.Error())
+	buf = buf[:n]
+
+	var (
+		ft     FileType
+		weight int
+	)
+	for k := range p.supportFileTypeMap {
+		// 权重相同时按类型标识排序, 保证结果稳定
+		if w := k.match(buf); w > weight || (w > 0 && w == weight && k < ft) {
+			ft, weight = k, w
+		}
 	}
 
-	resp, err := httpsSupportClient.Do(req)
+	if weight == 0 {
+		return "", nil, ErrCodeUnsupportedFileType.Error("不支持当前原始的文件类型")
+	}
+	return ft, io.MultiReader(bytes.NewReader(buf), src), nil
+}
+
+// writeSupportFile 向目标写入支持的文件
+func (p *Parser) writeSupportFile(src io.Reader, target io.Writer) (FileType, error) {
+	ft, src, err := p.detectFileType(src)
 	if err != nil {
-		return "", ErrCodeHttpRequest.ErrorWithRawErrf(err, "访问http请求资源失败: %s", err.Error())
+		return "", err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		if resp.StatusCode == 404 {
-			return "", ErrCodeProtoFileNoExist.Errorf("http资源[%s]不存在", uri)
+	if _, err = io.Copy(target, src); err != nil {
+		if ErrCodeFileSize.Equal(err) || ErrCodeChecksumMismatch.Equal(err) {
+			return "", err
 		}
-		return "", ErrCodeResStatusCode.Errorf("非法的http响应状态码: %d", resp.StatusCode)
+		return "", ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "向目标文件写出内容失败: %s", err)
 	}
 
-	return p.writeSupportFile(resp.Body, w)
+	return ft, nil
+}
+
+// Copy 拷贝文件流
+func (p *Parser) Copy(reader io.Reader, writer io.Writer) (FileType, error) {
+	return p.CopyContext(context.Background(), reader, writer)
 }
 
-// fileProtoWrite file协议文件写出
-// 文件协议如下类似, 以file://开头
-// Windows:  file://C:\Windows\System32\cmd.exe
-// Linux:    file:///usr/bin/ls
-func (p *Parser) fileProtoWrite(uri string, w io.Writer) (FileType, error) {
-	localPath := uri[7:]
-	if stat, err := os.Stat(localPath); err != nil || stat.IsDir() {
-		return "", ErrCodeProtoFileNoExist.ErrorWithRawErrf(err, "本地文件[%s]不存在", localPath)
+// CopyContext 拷贝文件流, 应用解析器的大小限制、限速及进度回调, 上下文结束时中断拷贝并返回 ErrCodeContextDone
+func (p *Parser) CopyContext(ctx context.Context, reader io.Reader, writer io.Writer) (FileType, error) {
+	if reader == nil {
+		return "", ErrCodeEmptyStream.Error("读取流不能为空")
 	}
 
-	f, err := os.OpenFile(localPath, os.O_RDONLY, 0655)
+	size := readerSize(reader)
+	r, err := p.newSizeLimitReader(reader, size)
 	if err != nil {
-		return "", ErrCodeProtoFileOpen.ErrorWithRawErrf(err, "打开本地文件[%s]失败: %s", localPath, err.Error())
+		return "", err
 	}
-	defer f.Close()
 
-	return p.writeSupportFile(f, w)
+	r = p.newRateLimitReader(ctx, r)
+	return p.copyStream(ctx, p.newProgressReader(r, size, ProgressPhaseTransfer), writer)
 }
 
-// Copy 拷贝文件流
-func (p *Parser) Copy(reader io.Reader, writer io.Writer) (FileType, error) {
+// copyStream 拷贝已应用大小限制、限速及进度回调的文件流, 内部写出时使用, 避免重复包装
+func (p *Parser) copyStream(ctx context.Context, reader io.Reader, writer io.Writer) (FileType, error) {
 	if reader == nil {
 		return "", ErrCodeEmptyStream.Error("读取流不能为空")
 	}
@@ -165,48 +236,151 @@ func (p *Parser) Copy(reader io.Reader, writer io.Writer) (FileType, error) {
 		return "", ErrCodeEmptyStream.Error("写出流不能为空")
 	}
 
-	return p.writeSupportFile(reader, writer)
+	t, err := p.writeSupportFile(withContextReader(ctx, reader), writer)
+	if err = contextError(ctx, err); err != nil {
+		return "", err
+	}
+	return t, nil
 }
 
 // CopyByURI 拷贝文件通过路径
 func (p *Parser) CopyByURI(srcFilePath, targetFilePath string) (FileType, error) {
-	return p.CopyWithOption(WithEmptySourceOption().SetUri(srcFilePath), WithEmptyTargetOption().SetUri(targetFilePath))
+	return p.CopyByURIContext(context.Background(), srcFilePath, targetFilePath)
+}
+
+// CopyByURIContext 拷贝文件通过路径, 上下文结束时中断拷贝并返回 ErrCodeContextDone
+func (p *Parser) CopyByURIContext(ctx context.Context, srcFilePath, targetFilePath string) (FileType, error) {
+	return p.CopyWithOptionContext(ctx, WithEmptySourceOption().SetUri(srcFilePath), WithEmptyTargetOption().SetUri(targetFilePath))
 }
 
 // CopyWithOption 拷贝文件通过选项
 func (p *Parser) CopyWithOption(src *sourceOption, target *targetOption) (FileType, error) {
+	return p.CopyWithOptionContext(context.Background(), src, target)
+}
+
+// CopyWithOptionContext 拷贝文件通过选项, 上下文结束时中断拷贝并返回 ErrCodeContextDone
+func (p *Parser) CopyWithOptionContext(ctx context.Context, src *sourceOption, target *targetOption) (FileType, error) {
+	res, err := p.CopyWithResultContext(ctx, src, target)
+	if err != nil {
+		return "", err
+	}
+	return res.FileType, nil
+}
+
+// CopyWithResult 拷贝文件通过选项, 拷贝的同时计算指定算法的摘要并与文件类型一并返回
+func (p *Parser) CopyWithResult(src *sourceOption, target *targetOption, algorithms ...HashAlgorithm) (*CopyResult, error) {
+	return p.CopyWithResultContext(context.Background(), src, target, algorithms...)
+}
+
+// CopyWithResultContext 拷贝文件通过选项, 拷贝的同时计算指定算法的摘要并与文件类型一并返回, 上下文结束时中断拷贝并返回 ErrCodeContextDone
+func (p *Parser) CopyWithResultContext(ctx context.Context, src *sourceOption, target *targetOption, algorithms ...HashAlgorithm) (*CopyResult, error) {
 	var (
 		t   FileType
+		req *TargetRequest
 		err error
 	)
 
-	if e := src.parse(func(r io.Reader) error {
-		t, err = target.writeByReader(r, p)
+	expected, err := src.expectedChecksum()
+	if err != nil {
+		return nil, err
+	}
+
+	cr, err := newChecksumReader(nil, expected, algorithms...)
+	if err != nil {
+		return nil, err
+	}
+
+	if e := src.parse(ctx, p, func(r io.Reader, size int64, modTime time.Time) error {
+		if r, err = p.newSizeLimitReader(r, size, src.sizeLimit, target.sizeLimit); err != nil {
+			return nil
+		}
+
+		r = p.newRateLimitReader(ctx, r, src.rateLimiter, target.rateLimiter)
+		cr.r = p.newProgressReader(r, size, target.progressPhase(), src.progress, target.progress)
+		if t, req, err = target.writeByReader(ctx, withContextReader(ctx, cr), p, modTime); err == nil {
+			err = cr.verify()
+		} else if cr.verifyErr != nil {
+			err = cr.verifyErr
+		}
 		return nil
 	}); e != nil {
-		return "", e
+		return nil, contextError(ctx, e)
 	}
-	return t, err
+
+	if err = contextError(ctx, err); err != nil {
+		return nil, err
+	}
+
+	res := cr.result(t)
+	if req != nil {
+		res.Location = req.Location
+		res.Outcome = req.Outcome
+	}
+	return res, nil
 }
 
 func (p *Parser) CopyToBytes(srcFile string) (FileType, BytesResult, error) {
-	return p.CopyToBytesWithOption(WithEmptySourceOption().SetUri(srcFile))
+	return p.CopyToBytesContext(context.Background(), srcFile)
+}
+
+// CopyToBytesContext 拷贝文件至内存, 上下文结束时中断拷贝并返回 ErrCodeContextDone
+func (p *Parser) CopyToBytesContext(ctx context.Context, srcFile string) (FileType, BytesResult, error) {
+	return p.CopyToBytesWithOptionContext(ctx, WithEmptySourceOption().SetUri(srcFile))
 }
 
 func (p *Parser) CopyToBytesWithOption(srcFile *sourceOption) (FileType, BytesResult, error) {
+	return p.CopyToBytesWithOptionContext(context.Background(), srcFile)
+}
+
+// CopyToBytesWithOptionContext 通过选项拷贝文件至内存, 上下文结束时中断拷贝并返回 ErrCodeContextDone
+func (p *Parser) CopyToBytesWithOptionContext(ctx context.Context, srcFile *sourceOption) (FileType, BytesResult, error) {
+	res, data, err := p.CopyToBytesWithResultContext(ctx, srcFile)
+	if err != nil {
+		return "", nil, err
+	}
+	return res.FileType, data, nil
+}
+
+// CopyToBytesWithResult 通过选项拷贝文件至内存, 拷贝的同时计算指定算法的摘要并与文件类型一并返回
+func (p *Parser) CopyToBytesWithResult(srcFile *sourceOption, algorithms ...HashAlgorithm) (*CopyResult, BytesResult, error) {
+	return p.CopyToBytesWithResultContext(context.Background(), srcFile, algorithms...)
+}
+
+// CopyToBytesWithResultContext 通过选项拷贝文件至内存, 拷贝的同时计算指定算法的摘要并与文件类型一并返回, 上下文结束时中断拷贝并返回 ErrCodeContextDone
+func (p *Parser) CopyToBytesWithResultContext(ctx context.Context, srcFile *sourceOption, algorithms ...HashAlgorithm) (*CopyResult, BytesResult, error) {
 	var t FileType
+	expected, err := srcFile.expectedChecksum()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cr, err := newChecksumReader(nil, expected, algorithms...)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	buf := &bytes.Buffer{}
-	if err := srcFile.parse(func(r io.Reader) error {
-		fileType, err := p.Copy(r, buf)
+	if err = srcFile.parse(ctx, p, func(r io.Reader, size int64, _ time.Time) error {
+		r, err := p.newSizeLimitReader(r, size, srcFile.sizeLimit)
+		if err != nil {
+			return err
+		}
+
+		r = p.newRateLimitReader(ctx, r, srcFile.rateLimiter)
+		cr.r = p.newProgressReader(r, size, ProgressPhaseTransfer, srcFile.progress)
+		fileType, err := p.copyStream(ctx, cr, buf)
 		if err != nil {
+			if ErrCodeContextDone.Equal(err) || ErrCodeFileSize.Equal(err) || ErrCodeChecksumMismatch.Equal(err) || ErrCodeEmptyFile.Equal(err) {
+				return err
+			}
 			return ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "拷贝文件数据失败: %s", err.Error())
 		}
 		t = fileType
-		return nil
+		return cr.verify()
 	}); err != nil {
-		return "", nil, err
+		return nil, nil, contextError(ctx, err)
 	}
-	return t, buf.Bytes(), nil
+	return cr.result(t), buf.Bytes(), nil
 }
 
 type BytesResult []byte
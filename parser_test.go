@@ -1,7 +1,9 @@
 package fileaddrhandler
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/json"
 	"github.com/stretchr/testify/assert"
 	"io"
 	"io/ioutil"
@@ -9,7 +11,11 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 var (
@@ -134,6 +140,179 @@ func TestParser_FileProtoWrite(t *testing.T) {
 	a.Equal(srcBytes, targetBytes)
 }
 
+func TestParser_FileAtomicWrite(t *testing.T) {
+	a := assert.New(t)
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	dir := t.TempDir()
+	targetPath := filepath.Join(dir, "atomic.pdf")
+	parser := New(FileTypePDF)
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetReader(bytes.NewReader([]byte("not a pdf file"))), WithEmptyTargetOption().SetUri("file://"+targetPath))
+	if !a.True(ErrCodeUnsupportedFileType.Equal(err)) {
+		return
+	}
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetReader(io.MultiReader(bytes.NewReader(srcBytes[:1024]), iotest.ErrReader(io.ErrUnexpectedEOF))),
+		WithEmptyTargetOption().SetUri("file://"+targetPath))
+	if !a.Error(err) {
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if !a.NoError(err) || !a.Empty(entries) {
+		return
+	}
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetReader(bytes.NewReader(srcBytes)), WithEmptyTargetOption().SetUri("file://"+targetPath))
+	if !a.NoError(err) {
+		return
+	}
+
+	targetBytes, err := ioutil.ReadFile(targetPath)
+	if !a.NoError(err) || !a.Equal(srcBytes, targetBytes) {
+		return
+	}
+
+	entries, err = os.ReadDir(dir)
+	if !a.NoError(err) {
+		return
+	}
+	a.Len(entries, 1)
+}
+
+func TestParser_FileTargetAttributes(t *testing.T) {
+	a := assert.New(t)
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	lastModified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		_, _ = w.Write(srcBytes)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	parser := New(FileTypePDF)
+
+	uid, gid := os.Getuid(), os.Getgid()
+	targetPath := filepath.Join(dir, "sub", "attr.pdf")
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri(server.URL+"/"+srcFile),
+		WithFileTargetOption(&TargetFileOption{FileMode: 0600, DirMode: 0700, Uid: &uid, Gid: &gid, PreserveModTime: true}).SetUri("file://"+targetPath))
+	if !a.NoError(err) {
+		return
+	}
+
+	stat, err := os.Stat(targetPath)
+	if !a.NoError(err) || !a.Equal(os.FileMode(0600), stat.Mode().Perm()) || !a.True(lastModified.Equal(stat.ModTime())) {
+		return
+	}
+
+	dirStat, err := os.Stat(filepath.Dir(targetPath))
+	if !a.NoError(err) || !a.Equal(os.FileMode(0700), dirStat.Mode().Perm()) {
+		return
+	}
+
+	// 目录权限不受umask影响
+	targetPath = filepath.Join(dir, "open", "sub", "attr.pdf")
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri("file://"+srcFile),
+		WithFileTargetOption(&TargetFileOption{DirMode: 0777}).SetUri("file://"+targetPath))
+	if !a.NoError(err) {
+		return
+	}
+
+	for _, p := range []string{filepath.Dir(targetPath), filepath.Join(dir, "open")} {
+		dirStat, err = os.Stat(p)
+		if !a.NoError(err) || !a.Equal(os.FileMode(0777), dirStat.Mode().Perm(), p) {
+			return
+		}
+	}
+
+	srcStat, err := os.Stat(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	targetPath = filepath.Join(dir, "local.pdf")
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri("file://"+srcFile),
+		WithAnyTargetOption(`{"PreserveModTime":true}`).SetUri("file://"+targetPath))
+	if !a.NoError(err) {
+		return
+	}
+
+	stat, err = os.Stat(targetPath)
+	if !a.NoError(err) || !a.Equal(defaultFileMode, stat.Mode().Perm()) || !a.True(srcStat.ModTime().Equal(stat.ModTime())) {
+		return
+	}
+
+	_, err = parser.CopyByURI("file://"+srcFile, "file://"+filepath.Join(targetPath, "child.pdf"))
+	a.True(ErrCodeMkdir.Equal(err))
+}
+
+func TestParser_ShortReads(t *testing.T) {
+	a := assert.New(t)
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	parser := New(FileTypePDF, FileTypeOFD)
+
+	buf := &bytes.Buffer{}
+	ft, err := parser.Copy(iotest.OneByteReader(bytes.NewReader(srcBytes)), buf)
+	if !a.NoError(err) || !a.Equal(FileTypePDF, ft) || !a.Equal(srcBytes, buf.Bytes()) {
+		return
+	}
+
+	// 每次只发送一个字节的http响应体
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 64; i++ {
+			_, _ = w.Write(srcBytes[i : i+1])
+			w.(http.Flusher).Flush()
+		}
+		_, _ = w.Write(srcBytes[64:])
+	}))
+	defer server.Close()
+
+	ft, res, err := parser.CopyToBytes(server.URL + "/" + srcFile)
+	if !a.NoError(err) || !a.Equal(FileTypePDF, ft) || !a.Equal(srcBytes, []byte(res)) {
+		return
+	}
+
+	// 短于文件头长度的文件按已读取的内容识别
+	ft, err = parser.Copy(iotest.OneByteReader(bytes.NewReader(srcBytes[:8])), ioutil.Discard)
+	if !a.NoError(err) || !a.Equal(FileTypePDF, ft) {
+		return
+	}
+
+	_, err = parser.Copy(bytes.NewReader(nil), ioutil.Discard)
+	if !a.True(ErrCodeEmptyFile.Equal(err)) {
+		return
+	}
+
+	emptyFile := filepath.Join(t.TempDir(), "empty.pdf")
+	if !a.NoError(ioutil.WriteFile(emptyFile, nil, 0644)) {
+		return
+	}
+
+	_, _, err = parser.CopyToBytes("file://" + emptyFile)
+	if !a.True(ErrCodeEmptyFile.Equal(err)) {
+		return
+	}
+
+	_, err = parser.CopyByURI("file://"+emptyFile, "file://"+filepath.Join(t.TempDir(), "target.pdf"))
+	a.True(ErrCodeEmptyFile.Equal(err))
+}
+
 func TestParser_HttpProtoWrite(t *testing.T) {
 	var err error
 	defer os.RemoveAll(targetFile)
@@ -150,6 +329,10 @@ func TestParser_HttpProtoWrite(t *testing.T) {
 	httpsSrcUri := httpsServer.URL
 
 	parser := New(FileTypePDF)
+	if err = parser.SetTLSOption(&TLSOption{RootCAs: testServerCertPem(httpsServer)}); !a.NoError(err) {
+		return
+	}
+
 	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri(httpSrcUri+"/"+targetFile), WithEmptyTargetOption().SetWriter(os.Stdout))
 	if !a.True(ErrCodeProtoFileNoExist.Equal(err)) {
 		return
@@ -177,7 +360,13 @@ func TestParser_HttpProtoWrite(t *testing.T) {
 		return
 	}
 
-	ft, err = parser.CopyByURI(httpsSrcUri+"/"+srcFile, "file://"+targetFile)
+	_, err = parser.CopyByURI(httpsSrcUri+"/"+srcFile, "file://"+targetFile)
+	if !a.True(ErrCodeFileExists.Equal(err)) {
+		return
+	}
+
+	ft, err = parser.CopyWithOption(WithEmptySourceOption().SetUri(httpsSrcUri+"/"+srcFile),
+		WithFileTargetOption(&TargetFileOption{Overwrite: OverwriteReplace}).SetUri("file://"+targetFile))
 	if !a.NoError(err) {
 		return
 	}
@@ -325,3 +514,199 @@ func TestCopyToHttp(t *testing.T) {
 
 	a.Equal(srcBytes, targetBytes)
 }
+
+func TestCopyToHttpBodyMode(t *testing.T) {
+	a := assert.New(t)
+
+	var (
+		contentType string
+		body        []byte
+	)
+	httpUploadServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		contentType = request.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(request.Body)
+		writer.WriteHeader(200)
+	}))
+	defer httpUploadServer.Close()
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	parser := New(FileTypePDF)
+	ft, err := parser.CopyWithOption(WithEmptySourceOption().SetUri("file://"+srcFile),
+		WithHttpTargetOption(&TargetHttpOption{
+			Method:   "PUT",
+			BodyMode: HttpBodyRaw,
+		}).SetUri(httpUploadServer.URL+"/"+targetFile))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) {
+		return
+	}
+
+	if !a.Equal("application/pdf", contentType) || !a.Equal(srcBytes, body) {
+		return
+	}
+
+	ft, err = parser.CopyWithOption(WithEmptySourceOption().SetUri("file://"+srcFile),
+		WithHttpTargetOption(&TargetHttpOption{
+			FieldName: "content",
+			Form:      map[string]string{"name": "test.pdf"},
+			BodyMode:  HttpBodyBase64Json,
+		}).SetUri(httpUploadServer.URL+"/"+targetFile))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) {
+		return
+	}
+
+	var jsonBody map[string]string
+	if !a.Equal("application/json", contentType) || !a.NoError(json.Unmarshal(body, &jsonBody)) {
+		return
+	}
+
+	if !a.Equal("test.pdf", jsonBody["name"]) || !a.Equal(base64.StdEncoding.EncodeToString(srcBytes), jsonBody["content"]) {
+		return
+	}
+
+	body = nil
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetReader(bytes.NewReader([]byte("not a pdf file"))),
+		WithHttpTargetOption(&TargetHttpOption{BodyMode: HttpBodyRaw}).SetUri(httpUploadServer.URL+"/"+targetFile))
+	if !a.True(ErrCodeUnsupportedFileType.Equal(err)) {
+		return
+	}
+
+	if !a.Nil(body) {
+		return
+	}
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri("file://"+srcFile),
+		WithHttpTargetOption(&TargetHttpOption{BodyMode: "xml"}).SetUri(httpUploadServer.URL+"/"+targetFile))
+	a.True(ErrOption.Equal(err))
+}
+
+func TestCopyToHttpResponse(t *testing.T) {
+	a := assert.New(t)
+
+	httpUploadServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = ioutil.ReadAll(request.Body)
+		if request.URL.Path == "/fail" {
+			writer.WriteHeader(http.StatusBadRequest)
+			_, _ = writer.Write([]byte(`{"msg":"bad request"}`))
+			return
+		}
+		writer.Header().Set("X-Doc-Id", "1001")
+		writer.WriteHeader(http.StatusCreated)
+		_, _ = writer.Write([]byte(`{"data":{"id":"1001","url":"http://127.0.0.1/docs/1001"}}`))
+	}))
+	defer httpUploadServer.Close()
+
+	parser := New(FileTypePDF)
+
+	res := &HttpResponse{}
+	ft, err := parser.CopyWithOption(WithEmptySourceOption().SetUri("file://"+srcFile),
+		WithHttpTargetOption(&TargetHttpOption{Response: res}).SetUri(httpUploadServer.URL+"/upload"))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) {
+		return
+	}
+
+	if !a.Equal(http.StatusCreated, res.StatusCode) || !a.Equal("1001", res.Header.Get("X-Doc-Id")) {
+		return
+	}
+
+	id, ok := res.JSONField("data.id")
+	if !a.True(ok) || !a.Equal("1001", id) {
+		return
+	}
+
+	if _, ok = res.JSONField("data.name"); !a.False(ok) {
+		return
+	}
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri("file://"+srcFile),
+		WithHttpTargetOption(&TargetHttpOption{Response: res}).SetUri(httpUploadServer.URL+"/fail"))
+	if !a.True(ErrCodeTargetFileWrite.Equal(err)) {
+		return
+	}
+
+	msg, ok := res.JSONField("msg")
+	a.True(ok)
+	a.Equal(http.StatusBadRequest, res.StatusCode)
+	a.Equal("bad request", msg)
+}
+
+// testCountTransport 记录请求次数的传输层
+type testCountTransport struct {
+	count int32
+}
+
+func (t *testCountTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.count, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestParser_HttpClient(t *testing.T) {
+	a := assert.New(t)
+
+	server := httptest.NewServer(downloadHttpHandFunc)
+	defer server.Close()
+
+	srcUri := server.URL + "/" + srcFile
+
+	parserTransport := &testCountTransport{}
+	parser := New(FileTypePDF)
+	parser.SetRoundTripper(parserTransport)
+
+	ft, err := parser.CopyWithOption(WithEmptySourceOption().SetUri(srcUri), WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) || !a.Equal(int32(1), parserTransport.count) {
+		return
+	}
+
+	optionTransport := &testCountTransport{}
+	_, err = parser.CopyWithOption(WithHttpSourceOption(&SourceHttpOption{Transport: optionTransport}).SetUri(srcUri),
+		WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(int32(1), parserTransport.count) || !a.Equal(int32(1), optionTransport.count) {
+		return
+	}
+
+	clientTransport := &testCountTransport{}
+	_, err = parser.CopyWithOption(WithHttpSourceOption(&SourceHttpOption{Client: &http.Client{Transport: clientTransport}}).SetUri(srcUri),
+		WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(int32(1), parserTransport.count) || !a.Equal(int32(1), clientTransport.count) {
+		return
+	}
+
+	if !a.True(ErrOption.Equal(parser.SetTLSOption(&TLSOption{InsecureSkipVerify: true}))) {
+		return
+	}
+
+	parser.SetHttpClient(nil)
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri(srcUri), WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.NoError(err) {
+		return
+	}
+
+	a.Equal(int32(1), parserTransport.count)
+}
@@ -0,0 +1,151 @@
+package fileaddrhandler
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// defaultProgressInterval 默认的进度回调间隔
+const defaultProgressInterval = 500 * time.Millisecond
+
+// ProgressPhase 拷贝进度所处的阶段
+type ProgressPhase string
+
+const (
+	// ProgressPhaseDetect 读取文件头识别文件类型
+	ProgressPhaseDetect ProgressPhase = "detect"
+	// ProgressPhaseTransfer 写出到本地文件或内存
+	ProgressPhaseTransfer ProgressPhase = "transfer"
+	// ProgressPhaseUpload 写出到远程地址
+	ProgressPhaseUpload ProgressPhase = "upload"
+)
+
+// Progress 拷贝进度
+type Progress struct {
+	// Phase 当前阶段
+	Phase ProgressPhase
+	// Transferred 已读取的字节数
+	Transferred int64
+	// Total 总字节数, 未知时为-1
+	Total int64
+	// Done 是否已读取完成
+	Done bool
+}
+
+// ProgressFunc 进度回调
+type ProgressFunc func(progress Progress)
+
+// progressHook 进度回调及回调间隔
+type progressHook struct {
+	fn       ProgressFunc
+	interval time.Duration
+	last     time.Time
+}
+
+// newProgressHook 创建进度回调, 间隔小于等于0时使用默认间隔
+func newProgressHook(fn ProgressFunc, interval time.Duration) *progressHook {
+	if fn == nil {
+		return nil
+	}
+
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	return &progressHook{fn: fn, interval: interval}
+}
+
+// SetProgress 设置拷贝进度回调, interval 为回调间隔, 小于等于0时使用默认的500毫秒, fn 为空时取消回调
+func (p *Parser) SetProgress(fn ProgressFunc, interval time.Duration) {
+	p.progress = newProgressHook(fn, interval)
+}
+
+// progressReader 读取时按间隔回调进度的读取流
+type progressReader struct {
+	r     io.Reader
+	hooks []progressHook
+	phase ProgressPhase
+	total int64
+	// header 识别文件类型需要读取的文件头长度, 读取完成前处于识别阶段
+	header  int64
+	n       int64
+	started bool
+	done    bool
+}
+
+// newProgressReader 包装读取流, 选项中的回调优先于解析器的回调, 均未设置时原样返回
+func (p *Parser) newProgressReader(r io.Reader, total int64, phase ProgressPhase, optionHooks ...*progressHook) io.Reader {
+	var hooks []progressHook
+	for _, hook := range optionHooks {
+		if hook != nil {
+			hooks = append(hooks, progressHook{fn: hook.fn, interval: hook.interval})
+		}
+	}
+
+	if len(hooks) == 0 && p.progress != nil {
+		hooks = append(hooks, progressHook{fn: p.progress.fn, interval: p.progress.interval})
+	}
+
+	if len(hooks) == 0 {
+		return r
+	}
+	return &progressReader{r: r, hooks: hooks, phase: phase, total: total, header: int64(p.headerSize())}
+}
+
+// Read 实现io.Reader接口
+func (r *progressReader) Read(p []byte) (int, error) {
+	if !r.started {
+		r.started = true
+		r.report(ProgressPhaseDetect, true)
+	}
+
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+
+	phase := r.phase
+	if r.n < r.header && err == nil {
+		phase = ProgressPhaseDetect
+	}
+
+	if err == io.EOF && !r.done {
+		r.done = true
+		r.report(phase, true)
+	} else {
+		r.report(phase, false)
+	}
+	return n, err
+}
+
+// report 回调进度, force 为false时按间隔回调
+func (r *progressReader) report(phase ProgressPhase, force bool) {
+	now := time.Now()
+	for i := range r.hooks {
+		hook := &r.hooks[i]
+		if !force && now.Sub(hook.last) < hook.interval {
+			continue
+		}
+		hook.last = now
+		hook.fn(Progress{Phase: phase, Transferred: r.n, Total: r.total, Done: r.done})
+	}
+}
+
+// readerSize 获取读取流的剩余长度, 未知时返回-1
+func readerSize(r io.Reader) int64 {
+	switch t := r.(type) {
+	case interface{ Len() int }:
+		return int64(t.Len())
+	case *os.File:
+		stat, err := t.Stat()
+		if err != nil || !stat.Mode().IsRegular() {
+			return -1
+		}
+
+		offset, err := t.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return stat.Size() - offset
+	default:
+		return -1
+	}
+}
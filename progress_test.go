@@ -0,0 +1,148 @@
+package fileaddrhandler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testProgressRecorder 记录进度回调
+type testProgressRecorder struct {
+	lock     sync.Mutex
+	progress []Progress
+}
+
+func (r *testProgressRecorder) record(progress Progress) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.progress = append(r.progress, progress)
+}
+
+func (r *testProgressRecorder) first() Progress {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.progress[0]
+}
+
+func (r *testProgressRecorder) last() Progress {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.progress[len(r.progress)-1]
+}
+
+func TestParser_Progress(t *testing.T) {
+	a := assert.New(t)
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+	total := int64(len(srcBytes))
+
+	parserRecorder := &testProgressRecorder{}
+	parser := New(FileTypePDF)
+	parser.SetProgress(parserRecorder.record, time.Nanosecond)
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri("file://"+srcFile), WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(Progress{Phase: ProgressPhaseDetect, Total: total}, parserRecorder.first()) ||
+		!a.Equal(Progress{Phase: ProgressPhaseTransfer, Transferred: total, Total: total, Done: true}, parserRecorder.last()) ||
+		!a.Greater(len(parserRecorder.progress), 2) {
+		return
+	}
+
+	server := httptest.NewServer(&testRangeServer{data: srcBytes})
+	defer server.Close()
+
+	parserRecorder.progress = nil
+	optionRecorder := &testProgressRecorder{}
+	_, _, err = parser.CopyToBytesWithOption(WithEmptySourceOption().SetUri(server.URL+"/"+srcFile).SetProgress(optionRecorder.record, time.Hour))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Empty(parserRecorder.progress) || !a.Len(optionRecorder.progress, 2) ||
+		!a.Equal(Progress{Phase: ProgressPhaseTransfer, Transferred: total, Total: total, Done: true}, optionRecorder.last()) {
+		return
+	}
+
+	_, _, err = parser.CopyToBytes("data:application/pdf;base64," + base64.StdEncoding.EncodeToString(srcBytes))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(Progress{Phase: ProgressPhaseTransfer, Transferred: total, Total: total, Done: true}, parserRecorder.last()) {
+		return
+	}
+
+	upload := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer upload.Close()
+
+	_, err = parser.CopyByURI("file://"+srcFile, upload.URL+"/upload")
+	if !a.NoError(err) {
+		return
+	}
+
+	a.Equal(Progress{Phase: ProgressPhaseUpload, Transferred: total, Total: total, Done: true}, parserRecorder.last())
+}
+
+func TestParser_CopyLimits(t *testing.T) {
+	a := assert.New(t)
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+	total := int64(len(srcBytes))
+
+	recorder := &testProgressRecorder{}
+	parser := New(FileTypePDF)
+	parser.SetProgress(recorder.record, time.Hour)
+
+	_, err = parser.Copy(bytes.NewReader(srcBytes), ioutil.Discard)
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Len(recorder.progress, 2) || !a.Equal(Progress{Phase: ProgressPhaseTransfer, Transferred: total, Total: total, Done: true}, recorder.last()) {
+		return
+	}
+
+	// 处理器通过 TargetRequest.Copy 写出时不重复回调进度
+	recorder.progress = nil
+	parser.RegisterTarget("mem", TargetHandlerFunc(func(req *TargetRequest, r io.Reader) (FileType, error) {
+		return req.Copy(r, ioutil.Discard)
+	}))
+
+	_, err = parser.CopyByURI("file://"+srcFile, "mem://copy.pdf")
+	if !a.NoError(err) || !a.Len(recorder.progress, 2) {
+		return
+	}
+
+	parser.SetSizeLimit(0, total/2)
+	_, err = parser.Copy(bytes.NewReader(srcBytes), ioutil.Discard)
+	if !a.True(ErrCodeFileSize.Equal(err)) {
+		return
+	}
+
+	parser.SetSizeLimit(0, 0)
+	parser.SetRateLimit(total*4, 32*1024)
+	start := time.Now()
+	_, err = parser.Copy(bytes.NewReader(append(srcBytes, srcBytes...)), ioutil.Discard)
+	if !a.NoError(err) {
+		return
+	}
+	a.GreaterOrEqual(time.Since(start), 250*time.Millisecond)
+}
@@ -0,0 +1,126 @@
+package fileaddrhandler
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter 令牌桶限速器, 令牌不足时记为欠账, 由后续的读取等待偿还, 保证多个并发拷贝共享时总速率受限
+type rateLimiter struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter 创建限速器, bytesPerSecond 小于等于0时不限速, burst 小于等于0时与 bytesPerSecond 相同
+func newRateLimiter(bytesPerSecond, burst int64) *rateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	if burst <= 0 {
+		burst = bytesPerSecond
+	}
+	return &rateLimiter{
+		rate:   float64(bytesPerSecond),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve 预占 n 个字节的令牌, 返回需要等待的时间
+func (l *rateLimiter) reserve(n int) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// SetRateLimit 设置解析器的总传输速率, 由该解析器发起的所有拷贝共享, bytesPerSecond 小于等于0时不限速
+func (p *Parser) SetRateLimit(bytesPerSecond, burst int64) {
+	p.rateLimiter = newRateLimiter(bytesPerSecond, burst)
+}
+
+// rateLimitReader 按限速器限制读取速率的读取流
+type rateLimitReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*rateLimiter
+	maxRead  int
+}
+
+// newRateLimitReader 包装读取流, 解析器与选项中的限速同时生效, 均未设置时原样返回
+func (p *Parser) newRateLimitReader(ctx context.Context, r io.Reader, optionLimiters ...*rateLimiter) io.Reader {
+	var limiters []*rateLimiter
+	if p.rateLimiter != nil {
+		limiters = append(limiters, p.rateLimiter)
+	}
+
+	for _, limiter := range optionLimiters {
+		if limiter != nil {
+			limiters = append(limiters, limiter)
+		}
+	}
+
+	if len(limiters) == 0 {
+		return r
+	}
+
+	lr := &rateLimitReader{ctx: ctx, r: r, limiters: limiters}
+	for _, limiter := range limiters {
+		if lr.maxRead == 0 || int(limiter.burst) < lr.maxRead {
+			lr.maxRead = int(limiter.burst)
+		}
+	}
+
+	if lr.maxRead < 1 {
+		lr.maxRead = 1
+	}
+	return lr
+}
+
+// Read 实现io.Reader接口, 单次读取不超过令牌桶容量
+func (l *rateLimitReader) Read(p []byte) (int, error) {
+	if len(p) > l.maxRead {
+		p = p[:l.maxRead]
+	}
+
+	n, err := l.r.Read(p)
+	if n <= 0 {
+		return n, err
+	}
+
+	var wait time.Duration
+	for _, limiter := range l.limiters {
+		if d := limiter.reserve(n); d > wait {
+			wait = d
+		}
+	}
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-l.ctx.Done():
+			return n, ErrCodeContextDone.ErrorWithRawErrf(l.ctx.Err(), "操作已取消: %s", l.ctx.Err().Error())
+		case <-timer.C:
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,70 @@
+package fileaddrhandler
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Reserve(t *testing.T) {
+	a := assert.New(t)
+
+	a.Nil(newRateLimiter(0, 10))
+
+	limiter := newRateLimiter(1000, 100)
+	a.Equal(time.Duration(0), limiter.reserve(100))
+
+	d := limiter.reserve(100)
+	a.True(d > 90*time.Millisecond && d <= 100*time.Millisecond)
+}
+
+func TestParser_RateLimit(t *testing.T) {
+	a := assert.New(t)
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+	srcBytes = srcBytes[:40*1024]
+
+	parser := New(FileTypePDF)
+	parser.SetRateLimit(200*1024, 10*1024)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := parser.CopyWithOption(WithEmptySourceOption().SetReader(bytes.NewReader(srcBytes)), WithEmptyTargetOption().SetWriter(ioutil.Discard))
+			a.NoError(err)
+		}()
+	}
+	wg.Wait()
+
+	// 共享限速: (2*40KB - 10KB) / 200KB/s = 350ms
+	if !a.GreaterOrEqual(time.Since(start), 300*time.Millisecond) {
+		return
+	}
+
+	parser.SetRateLimit(0, 0)
+	start = time.Now()
+	ft, _, err := parser.CopyToBytesWithOption(WithEmptySourceOption().SetReader(bytes.NewReader(srcBytes)).SetRateLimit(100*1024, 10*1024))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) || !a.GreaterOrEqual(time.Since(start), 250*time.Millisecond) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = parser.CopyWithOptionContext(ctx, WithEmptySourceOption().SetReader(bytes.NewReader(srcBytes)).SetRateLimit(1024, 1024),
+		WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	a.True(ErrCodeContextDone.Equal(err))
+}
@@ -0,0 +1,124 @@
+package fileaddrhandler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// defaultMaxResumes 默认的最大续传次数
+const defaultMaxResumes = 3
+
+// resumableBody 读取中断时自动续传的http响应体
+type resumableBody struct {
+	ctx  context.Context
+	send func(ctx context.Context, header http.Header) (*http.Response, error)
+	body io.ReadCloser
+	// offset 已读取的字节数
+	offset int64
+	// etag 首次响应的 ETag
+	etag string
+	// lastModified 首次响应的 Last-Modified
+	lastModified string
+	// acceptRanges 服务端是否支持 Range 请求
+	acceptRanges bool
+	resumes      int
+	maxResumes   int
+}
+
+// newResumableBody 基于首次响应创建可续传的响应体
+func newResumableBody(ctx context.Context, resp *http.Response, send func(ctx context.Context, header http.Header) (*http.Response, error), maxResumes int) *resumableBody {
+	if maxResumes <= 0 {
+		maxResumes = defaultMaxResumes
+	}
+
+	return &resumableBody{
+		ctx:          ctx,
+		send:         send,
+		body:         resp.Body,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		acceptRanges: strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes"),
+		maxResumes:   maxResumes,
+	}
+}
+
+// Read 实现io.Reader接口, 读取失败时按续传策略重新建立连接
+func (b *resumableBody) Read(p []byte) (int, error) {
+	for {
+		n, err := b.body.Read(p)
+		b.offset += int64(n)
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+
+		if n > 0 {
+			// 先交出已读取的内容, 下一次读取时再续传
+			return n, nil
+		}
+
+		if b.ctx.Err() != nil || b.resumes >= b.maxResumes {
+			return 0, err
+		}
+		b.resumes++
+
+		if resumeErr := b.resume(); resumeErr != nil {
+			return 0, ErrCodeProtoFileRead.ErrorWithRawErrf(err, "http资源读取中断且续传失败: %s", resumeErr.Error())
+		}
+	}
+}
+
+// ifRange If-Range 请求头使用的校验值, 弱校验的 ETag 不能用于 If-Range
+func (b *resumableBody) ifRange() string {
+	if b.etag != "" && !strings.HasPrefix(b.etag, "W/") {
+		return b.etag
+	}
+	return b.lastModified
+}
+
+// resume 从已读取的位置重新建立连接, 服务端不支持 Range 或资源发生变化时重新下载并跳过已读取的内容
+func (b *resumableBody) resume() error {
+	_ = b.body.Close()
+
+	header := http.Header{}
+	validator := b.ifRange()
+	if b.acceptRanges && validator != "" {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", b.offset))
+		header.Set("If-Range", validator)
+	}
+
+	resp, err := b.send(b.ctx, header)
+	if err != nil {
+		return err
+	}
+	b.body = resp.Body
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		var start int64
+		if _, err = fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-", &start); err != nil || start != b.offset {
+			return fmt.Errorf("非法的 Content-Range: %s", resp.Header.Get("Content-Range"))
+		}
+		return nil
+	case http.StatusOK:
+		if (b.etag != "" && resp.Header.Get("ETag") != b.etag) ||
+			(b.lastModified != "" && resp.Header.Get("Last-Modified") != b.lastModified) {
+			return fmt.Errorf("http资源已发生变化")
+		}
+
+		if _, err = io.CopyN(ioutil.Discard, resp.Body, b.offset); err != nil {
+			return err
+		}
+		return nil
+	default:
+		return fmt.Errorf("非法的http响应状态码: %d", resp.StatusCode)
+	}
+}
+
+// Close 关闭当前的响应体
+func (b *resumableBody) Close() error {
+	return b.body.Close()
+}
@@ -0,0 +1,117 @@
+package fileaddrhandler
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testAbortWriter 写出指定长度后中断连接的响应
+type testAbortWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (w *testAbortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n, _ := w.ResponseWriter.Write(p[:w.limit])
+		w.ResponseWriter.(http.Flusher).Flush()
+		w.limit -= n
+		panic(http.ErrAbortHandler)
+	}
+	w.limit -= len(p)
+	return w.ResponseWriter.Write(p)
+}
+
+// testResumeServer 前 aborts 次请求在传输一部分内容后中断的http服务
+type testResumeServer struct {
+	lock         sync.Mutex
+	data         []byte
+	acceptRanges bool
+	aborts       int
+	ranges       []string
+}
+
+func (s *testResumeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	abort := s.aborts > 0
+	s.aborts--
+	s.ranges = append(s.ranges, r.Header.Get("Range")+"|"+r.Header.Get("If-Range"))
+	s.lock.Unlock()
+
+	if abort {
+		w = &testAbortWriter{ResponseWriter: w, limit: len(s.data) / 3}
+	}
+
+	if s.acceptRanges {
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, srcFile, time.Time{}, bytes.NewReader(s.data))
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(s.data)))
+	_, _ = w.Write(s.data)
+}
+
+func TestParser_ResumeHttpSource(t *testing.T) {
+	a := assert.New(t)
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	fake := &testResumeServer{data: srcBytes, acceptRanges: true, aborts: 1}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	parser := New(FileTypePDF)
+
+	_, _, err = parser.CopyToBytes(server.URL + "/" + srcFile)
+	if !a.Error(err) {
+		return
+	}
+
+	fake.aborts, fake.ranges = 2, nil
+	ft, buf, err := parser.CopyToBytesWithOption(WithHttpSourceOption(&SourceHttpOption{Resume: true}).SetUri(server.URL + "/" + srcFile))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) || !a.Equal(srcBytes, []byte(buf)) {
+		return
+	}
+
+	third := len(srcBytes) / 3
+	if !a.Equal([]string{
+		"|",
+		"bytes=" + strconv.Itoa(third) + "-|\"v1\"",
+		"bytes=" + strconv.Itoa(third*2) + "-|\"v1\"",
+	}, fake.ranges) {
+		return
+	}
+
+	fake.aborts = 2
+	_, _, err = parser.CopyToBytesWithOption(WithHttpSourceOption(&SourceHttpOption{Resume: true, MaxResumes: 1}).SetUri(server.URL + "/" + srcFile))
+	if !a.Error(err) {
+		return
+	}
+
+	fake.acceptRanges, fake.aborts, fake.ranges = false, 1, nil
+	ft, buf, err = parser.CopyToBytesWithOption(WithHttpSourceOption(&SourceHttpOption{Resume: true}).SetUri(server.URL + "/" + srcFile))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) || !a.Equal(srcBytes, []byte(buf)) {
+		return
+	}
+
+	a.Equal([]string{"|", "|"}, fake.ranges)
+}
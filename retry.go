@@ -0,0 +1,234 @@
+package fileaddrhandler
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	// defaultRetryInitialBackoff 默认的首次重试等待时间
+	defaultRetryInitialBackoff = 200 * time.Millisecond
+	// defaultRetryMaxBackoff 默认的最大重试等待时间
+	defaultRetryMaxBackoff = 10 * time.Second
+	// defaultRetryableStatusCodes 默认可重试的响应状态码
+	defaultRetryableStatusCodes = []int{
+		http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+)
+
+// RetryPolicy 远程请求的重试策略, 网络错误及 RetryableStatusCodes 中的响应状态码会触发重试
+type RetryPolicy struct {
+	// MaxAttempts 最大尝试次数(包含首次请求), 小于等于1时不重试
+	MaxAttempts int
+	// InitialBackoff 首次重试的等待时间, 默认200毫秒
+	InitialBackoff time.Duration
+	// MaxBackoff 最大等待时间, 默认10秒
+	MaxBackoff time.Duration
+	// Multiplier 等待时间的增长倍数, 默认为2
+	Multiplier float64
+	// Jitter 随机抖动比例, 取值0~1, 等待时间在 [backoff*(1-Jitter), backoff] 之间随机
+	Jitter float64
+	// RetryableStatusCodes 可重试的响应状态码, 为空时使用 408, 429, 500, 502, 503, 504
+	RetryableStatusCodes []int
+	// IgnoreRetryAfter 忽略响应头中的 Retry-After
+	IgnoreRetryAfter bool
+}
+
+// retryable 判断响应状态码是否可重试
+func (r *RetryPolicy) retryable(statusCode int) bool {
+	codes := r.RetryableStatusCodes
+	if len(codes) == 0 {
+		codes = defaultRetryableStatusCodes
+	}
+
+	for _, code := range codes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff 计算第 attempt 次重试前的等待时间, 服务端返回 Retry-After 时优先使用
+func (r *RetryPolicy) backoff(attempt int, res *http.Response) time.Duration {
+	if res != nil && !r.IgnoreRetryAfter {
+		if d, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok {
+			return d
+		}
+	}
+
+	initial, max, multiplier := r.InitialBackoff, r.MaxBackoff, r.Multiplier
+	if initial <= 0 {
+		initial = defaultRetryInitialBackoff
+	}
+	if max <= 0 {
+		max = defaultRetryMaxBackoff
+	}
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	d := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if d > float64(max) {
+		d = float64(max)
+	}
+
+	if r.Jitter > 0 {
+		jitter := r.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		d -= d * jitter * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// parseRetryAfter 解析 Retry-After 响应头, 支持秒数及http时间格式
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(v); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+
+	d := time.Until(t)
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
+
+// do 按重试策略发送请求, send 每次调用都需构建新的请求, 重试前会关闭上一次的响应体.
+// send 返回的 *Error 类型错误视为不可重试, 其余错误视为网络错误重试.
+// 策略为空或重试次数耗尽时原样返回最后一次的响应或错误
+func (r *RetryPolicy) do(ctx context.Context, send func() (*http.Response, error)) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		res, err := send()
+		if r == nil || attempt >= r.MaxAttempts || ctx.Err() != nil {
+			return res, err
+		}
+
+		if err != nil {
+			if _, ok := ErrParse(err); ok {
+				return nil, err
+			}
+		} else if !r.retryable(res.StatusCode) {
+			return res, nil
+		}
+
+		wait := r.backoff(attempt, res)
+		if res != nil {
+			_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, 4096))
+			res.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryPolicyFor 获取单次操作使用的重试策略, 选项中的策略优先
+func (p *Parser) retryPolicyFor(option *RetryPolicy) *RetryPolicy {
+	if option != nil || p == nil {
+		return option
+	}
+	return p.retry
+}
+
+// SetRetryPolicy 设置远程请求的重试策略, 为空时不重试
+func (p *Parser) SetRetryPolicy(policy *RetryPolicy) {
+	p.retry = policy
+}
+
+// replayReader 可从头重放的读取流, 支持 io.Seeker 的读取流直接重新定位,
+// 否则在读取时缓存到临时文件, 重放时先读取缓存内容再继续读取原始流
+type replayReader struct {
+	r      io.Reader
+	start  int64
+	seeker io.Seeker
+	spool  *os.File
+	n      int64
+}
+
+// newReplayReader 创建可重放的读取流
+func newReplayReader(r io.Reader) *replayReader {
+	rr := &replayReader{r: r}
+	if seeker, ok := r.(io.Seeker); ok {
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			rr.seeker, rr.start = seeker, start
+		}
+	}
+	return rr
+}
+
+// reader 获取从头开始的读取流, 调用前需确保上一次获取的读取流已不再使用
+func (rr *replayReader) reader() (io.Reader, error) {
+	if rr.seeker != nil {
+		if _, err := rr.seeker.Seek(rr.start, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return rr.r, nil
+	}
+
+	if rr.spool == nil {
+		spool, err := ioutil.TempFile("", "file-addr-handler-spool-*")
+		if err != nil {
+			return nil, err
+		}
+		rr.spool = spool
+	}
+	return io.MultiReader(io.NewSectionReader(rr.spool, 0, rr.n), &replaySpoolReader{rr: rr}), nil
+}
+
+// Close 删除缓存文件
+func (rr *replayReader) Close() error {
+	if rr.spool == nil {
+		return nil
+	}
+	_ = rr.spool.Close()
+	return os.Remove(rr.spool.Name())
+}
+
+// replaySpoolReader 读取原始流并写入缓存文件
+type replaySpoolReader struct {
+	rr *replayReader
+}
+
+// Read 实现io.Reader接口
+func (s *replaySpoolReader) Read(p []byte) (int, error) {
+	n, err := s.rr.r.Read(p)
+	if n > 0 {
+		if _, werr := s.rr.spool.WriteAt(p[:n], s.rr.n); werr != nil {
+			return 0, werr
+		}
+		s.rr.n += int64(n)
+	}
+	return n, err
+}
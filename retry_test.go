@@ -0,0 +1,144 @@
+package fileaddrhandler
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testOnlyReader 隐藏原始读取流的其余接口, 模拟不可重新定位的读取流
+type testOnlyReader struct {
+	r io.Reader
+}
+
+func (o *testOnlyReader) Read(p []byte) (int, error) {
+	return o.r.Read(p)
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	a := assert.New(t)
+
+	policy := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	a.Equal(100*time.Millisecond, policy.backoff(1, nil))
+	a.Equal(400*time.Millisecond, policy.backoff(3, nil))
+	a.Equal(time.Second, policy.backoff(10, nil))
+
+	res := &http.Response{Header: http.Header{"Retry-After": {"3"}}}
+	a.Equal(3*time.Second, policy.backoff(1, res))
+
+	policy.IgnoreRetryAfter = true
+	a.Equal(100*time.Millisecond, policy.backoff(1, res))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		d := policy.backoff(1, nil)
+		a.True(d >= 50*time.Millisecond && d <= 100*time.Millisecond)
+	}
+
+	_, ok := parseRetryAfter("bad")
+	a.False(ok)
+
+	d, ok := parseRetryAfter(time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat))
+	a.True(ok)
+	a.Equal(time.Duration(0), d)
+}
+
+func TestParser_RetrySource(t *testing.T) {
+	a := assert.New(t)
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1)%3 != 0 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		downloadHttpHandFunc(w, r)
+	}))
+	defer server.Close()
+
+	srcUri := server.URL + "/" + srcFile
+	parser := New(FileTypePDF)
+
+	_, _, err := parser.CopyToBytes(srcUri)
+	if !a.True(ErrCodeResStatusCode.Equal(err)) {
+		return
+	}
+
+	atomic.StoreInt32(&hits, 0)
+	parser.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+	ft, _, err := parser.CopyToBytes(srcUri)
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) || !a.Equal(int32(3), atomic.LoadInt32(&hits)) {
+		return
+	}
+
+	atomic.StoreInt32(&hits, 0)
+	_, _, err = parser.CopyToBytesWithOption(WithHttpSourceOption(&SourceHttpOption{Retry: &RetryPolicy{MaxAttempts: 1}}).SetUri(srcUri))
+	if !a.True(ErrCodeResStatusCode.Equal(err)) {
+		return
+	}
+
+	a.Equal(int32(1), atomic.LoadInt32(&hits))
+}
+
+func TestParser_RetryTarget(t *testing.T) {
+	a := assert.New(t)
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	var (
+		hits     int32
+		uploaded []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&hits, 1)%2 != 0 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		uploaded = body
+	}))
+	defer server.Close()
+
+	parser := New(FileTypePDF)
+	parser.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond})
+
+	for _, src := range []*sourceOption{
+		WithEmptySourceOption().SetUri("file://" + srcFile),
+		WithEmptySourceOption().SetReader(&testOnlyReader{r: bytes.NewReader(srcBytes)}),
+	} {
+		atomic.StoreInt32(&hits, 0)
+		uploaded = nil
+
+		ft, err := parser.CopyWithOption(src, WithHttpTargetOption(&TargetHttpOption{BodyMode: HttpBodyRaw}).SetUri(server.URL+"/upload"))
+		if !a.NoError(err) {
+			return
+		}
+
+		if !a.Equal(FileTypePDF, ft) || !a.Equal(int32(2), atomic.LoadInt32(&hits)) || !a.Equal(srcBytes, uploaded) {
+			return
+		}
+	}
+
+	atomic.StoreInt32(&hits, 0)
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri("file://"+srcFile),
+		WithHttpTargetOption(&TargetHttpOption{Retry: &RetryPolicy{}}).SetUri(server.URL+"/upload"))
+	if !a.True(ErrCodeTargetFileWrite.Equal(err)) {
+		return
+	}
+
+	a.Equal(int32(1), atomic.LoadInt32(&hits))
+}
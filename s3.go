@@ -0,0 +1,500 @@
+package fileaddrhandler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// s3DefaultPartSize 默认的分片上传大小
+	s3DefaultPartSize = 8 * 1024 * 1024
+	// s3MinPartSize s3允许的最小分片大小, 最后一个分片除外
+	s3MinPartSize = 5 * 1024 * 1024
+)
+
+// S3Config s3兼容对象存储的连接配置, 未设置的认证信息取自 AWS_* 环境变量
+type S3Config struct {
+	// Endpoint 服务地址, 例如 http://127.0.0.1:9000, 为空时使用 https://s3.{Region}.amazonaws.com
+	Endpoint string
+	// Region 区域, 默认为 us-east-1
+	Region string
+	// AccessKeyId 访问密钥ID
+	AccessKeyId string
+	// SecretAccessKey 访问密钥
+	SecretAccessKey string
+	// SessionToken 临时凭证的会话令牌
+	SessionToken string
+	// PathStyle 是否使用路径方式访问bucket, 为false时使用虚拟主机方式
+	PathStyle bool
+	// TLS tls选项, 为空时使用解析器的配置
+	TLS *TLSOption
+	// Client http客户端, 为空时使用解析器的客户端
+	Client *http.Client `json:"-"`
+	// Transport http传输层, 不为空时替换客户端的传输层
+	Transport http.RoundTripper `json:"-"`
+	// Retry 重试策略, 为空时使用解析器的配置
+	Retry *RetryPolicy
+}
+
+// SourceS3Option 原始文件的s3选项
+type SourceS3Option struct {
+	S3Config
+}
+
+// TargetS3Option 目标文件的s3选项
+type TargetS3Option struct {
+	S3Config
+	// PartSize 分片上传的分片大小, 文件超过该大小时使用分片上传, 默认8MB, 不能小于5MB
+	PartSize int64
+	// ContentType 对象的内容类型
+	ContentType string
+}
+
+// withDefaults 填充默认值
+func (c S3Config) withDefaults() S3Config {
+	if c.Region == "" {
+		c.Region = os.Getenv("AWS_REGION")
+	}
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	if c.AccessKeyId == "" && c.SecretAccessKey == "" {
+		c.AccessKeyId = os.Getenv("AWS_ACCESS_KEY_ID")
+		c.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if c.SessionToken == "" {
+			c.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		}
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = "https://s3." + c.Region + ".amazonaws.com"
+	}
+	return c
+}
+
+// objectUrl 获取对象的访问地址
+func (c *S3Config) objectUrl(bucket, key string, query url.Values) (*url.URL, error) {
+	u, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, ErrOption.ErrorWithRawErrf(err, "解析s3服务地址[%s]失败: %s", c.Endpoint, err.Error())
+	}
+
+	if c.PathStyle {
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + bucket + "/" + key
+	} else {
+		u.Host = bucket + "." + u.Host
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + key
+	}
+
+	u.RawPath = s3UriEncode(u.Path, false)
+	if query != nil {
+		u.RawQuery = s3CanonicalQuery(query)
+	}
+	return u, nil
+}
+
+// newRequest 创建已签名的请求
+func (c *S3Config) newRequest(ctx context.Context, method string, bucket, key string, query url.Values, body []byte, header http.Header) (*http.Request, error) {
+	u, err := c.objectUrl(bucket, key, query)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, ErrCodeHttpRequestCreate.ErrorWithRawErrf(err, "创建s3请求对象失败: %s", err.Error())
+	}
+
+	for k := range header {
+		req.Header.Set(k, header.Get(k))
+	}
+
+	sum := sha256.Sum256(body)
+	c.sign(req, hex.EncodeToString(sum[:]), time.Now())
+	return req, nil
+}
+
+// sign 使用 AWS Signature Version 4 对请求签名
+func (c *S3Config) sign(req *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := &strings.Builder{}
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3UriEncode(req.URL.Path, false),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := s3Hmac([]byte("AWS4"+c.SecretAccessKey), date)
+	key = s3Hmac(key, c.Region)
+	key = s3Hmac(key, "s3")
+	key = s3Hmac(key, "aws4_request")
+	signature := hex.EncodeToString(s3Hmac(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKeyId, scope, signedHeaders, signature))
+}
+
+func s3Hmac(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3UriEncode 按照签名规范进行uri编码
+func s3UriEncode(s string, encodeSlash bool) string {
+	b := &strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// s3CanonicalQuery 规范化查询参数
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, s3UriEncode(k, true)+"="+s3UriEncode(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// s3Location 从地址中解析bucket与key
+func s3Location(u *url.URL) (string, string, error) {
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return "", "", ErrCodeUnsupportedProtocols.Errorf("非法的s3地址[%s], 格式应为 s3://bucket/key", u.String())
+	}
+	return bucket, key, nil
+}
+
+// s3ResponseError 读取s3错误响应
+func s3ResponseError(res *http.Response) string {
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+	var e struct {
+		Code    string
+		Message string
+	}
+	if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+		return fmt.Sprintf("%d %s: %s", res.StatusCode, e.Code, e.Message)
+	}
+	return strconv.Itoa(res.StatusCode)
+}
+
+// readS3Source 读取s3协议文件
+func readS3Source(req *SourceRequest, fn func(r io.Reader) error) error {
+	var (
+		option *SourceS3Option
+		err    error
+	)
+	if option, err = parseOptionData[SourceS3Option](req.Data); err != nil {
+		return err
+	}
+
+	if option == nil {
+		option = &SourceS3Option{}
+	}
+	config := option.S3Config.withDefaults()
+
+	bucket, key, err := s3Location(req.URL)
+	if err != nil {
+		return err
+	}
+
+	client, err := req.Parser.httpClientFor(config.Client, config.Transport, config.TLS)
+	if err != nil {
+		return err
+	}
+
+	ctx := requestContext(req.Context)
+	resp, err := req.Parser.retryPolicyFor(config.Retry).do(ctx, func() (*http.Response, error) {
+		httpReq, err := config.newRequest(ctx, http.MethodGet, bucket, key, nil, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		return client.Do(httpReq)
+	})
+	if _, ok := ErrParse(err); ok {
+		return err
+	}
+
+	if err != nil {
+		return ErrCodeHttpRequest.ErrorWithRawErrf(err, "访问s3对象失败: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if resp.StatusCode == 404 {
+			return ErrCodeProtoFileNoExist.Errorf("s3对象[%s/%s]不存在", bucket, key)
+		}
+		return ErrCodeResStatusCode.Errorf("访问s3对象失败: %s", s3ResponseError(resp))
+	}
+
+	req.Size = resp.ContentLength
+	req.ModTime = responseModTime(resp)
+	return fn(resp.Body)
+}
+
+// s3Writer s3对象写出, 内容超过分片大小时自动切换为分片上传
+type s3Writer struct {
+	ctx         context.Context
+	client      *http.Client
+	retry       *RetryPolicy
+	config      *S3Config
+	bucket      string
+	key         string
+	contentType string
+	partSize    int
+	buf         []byte
+	uploadId    string
+	parts       []s3CompletedPart
+}
+
+type s3CompletedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+// do 发送请求并校验状态码
+func (w *s3Writer) do(method string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	res, err := w.retry.do(w.ctx, func() (*http.Response, error) {
+		req, err := w.config.newRequest(w.ctx, method, w.bucket, w.key, query, body, header)
+		if err != nil {
+			return nil, err
+		}
+		return w.client.Do(req)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer res.Body.Close()
+		return nil, fmt.Errorf("s3服务返回错误: %s", s3ResponseError(res))
+	}
+	return res, nil
+}
+
+// Write 实现io.Writer接口
+func (w *s3Writer) Write(b []byte) (int, error) {
+	n := len(b)
+	for len(b) > 0 {
+		l := w.partSize - len(w.buf)
+		if l > len(b) {
+			l = len(b)
+		}
+		w.buf = append(w.buf, b[:l]...)
+		b = b[l:]
+
+		if len(w.buf) >= w.partSize {
+			if err := w.uploadPart(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// uploadPart 上传缓冲区中的分片
+func (w *s3Writer) uploadPart() error {
+	if w.uploadId == "" {
+		header := http.Header{}
+		if w.contentType != "" {
+			header.Set("Content-Type", w.contentType)
+		}
+		res, err := w.do(http.MethodPost, url.Values{"uploads": {""}}, nil, header)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		var result struct {
+			UploadId string
+		}
+		if err = xml.NewDecoder(res.Body).Decode(&result); err != nil {
+			return err
+		}
+		w.uploadId = result.UploadId
+	}
+
+	partNumber := len(w.parts) + 1
+	res, err := w.do(http.MethodPut, url.Values{
+		"partNumber": {strconv.Itoa(partNumber)},
+		"uploadId":   {w.uploadId},
+	}, w.buf, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	w.parts = append(w.parts, s3CompletedPart{PartNumber: partNumber, ETag: res.Header.Get("ETag")})
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close 完成上传
+func (w *s3Writer) Close() error {
+	if w.uploadId == "" {
+		header := http.Header{}
+		if w.contentType != "" {
+			header.Set("Content-Type", w.contentType)
+		}
+		res, err := w.do(http.MethodPut, nil, w.buf, header)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	}
+
+	if len(w.buf) > 0 {
+		if err := w.uploadPart(); err != nil {
+			return err
+		}
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+		Parts   []s3CompletedPart `xml:"Part"`
+	}{Parts: w.parts})
+	if err != nil {
+		return err
+	}
+
+	res, err := w.do(http.MethodPost, url.Values{"uploadId": {w.uploadId}}, body, nil)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// Abort 取消分片上传, 上下文已结束时仍需清理服务端的分片
+func (w *s3Writer) Abort() {
+	if w.uploadId == "" {
+		return
+	}
+	w.ctx = context.Background()
+	if res, err := w.do(http.MethodDelete, url.Values{"uploadId": {w.uploadId}}, nil, nil); err == nil {
+		res.Body.Close()
+	}
+}
+
+// writeS3Target 写出到s3协议地址
+func writeS3Target(req *TargetRequest, r io.Reader) (FileType, error) {
+	var (
+		option *TargetS3Option
+		err    error
+	)
+	if option, err = parseOptionData[TargetS3Option](req.Data); err != nil {
+		return "", err
+	}
+
+	if option == nil {
+		option = &TargetS3Option{}
+	}
+	config := option.S3Config.withDefaults()
+
+	bucket, key, err := s3Location(req.URL)
+	if err != nil {
+		return "", err
+	}
+
+	partSize := option.PartSize
+	if partSize <= 0 {
+		partSize = s3DefaultPartSize
+	} else if partSize < s3MinPartSize {
+		return "", ErrOption.Errorf("s3分片大小[%d]不能小于%d", partSize, s3MinPartSize)
+	}
+
+	client, err := req.Parser.httpClientFor(config.Client, config.Transport, config.TLS)
+	if err != nil {
+		return "", err
+	}
+
+	w := &s3Writer{
+		ctx:         requestContext(req.Context),
+		client:      client,
+		retry:       req.Parser.retryPolicyFor(config.Retry),
+		config:      &config,
+		bucket:      bucket,
+		key:         key,
+		contentType: option.ContentType,
+		partSize:    int(partSize),
+	}
+
+	fileType, err := req.Copy(r, w)
+	if err != nil {
+		w.Abort()
+		return "", err
+	}
+
+	if err = w.Close(); err != nil {
+		w.Abort()
+		return "", ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "向s3对象[%s/%s]写出内容失败: %s", bucket, key, err.Error())
+	}
+	return fileType, nil
+}
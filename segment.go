@@ -0,0 +1,196 @@
+package fileaddrhandler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// defaultMinSegmentSize 默认的最小分段长度
+const defaultMinSegmentSize = 1024 * 1024
+
+// httpSegment 分段下载的一个分段
+type httpSegment struct {
+	start int64
+	end   int64
+	done  chan struct{}
+	err   error
+}
+
+// segmentedBody 分段并发下载的响应体, 首段直接读取首次响应, 保证文件类型校验先于其余分段完成,
+// 其余分段并发下载到临时文件后按顺序读取
+type segmentedBody struct {
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	first    io.ReadCloser
+	firstN   int64
+	spool    *os.File
+	segments []*httpSegment
+	idx      int
+	cur      io.Reader
+}
+
+// newSegmentedBody 服务端支持 Range 且内容足够大时创建分段下载的响应体, 不满足条件时返回nil
+func newSegmentedBody(ctx context.Context, resp *http.Response, send func(ctx context.Context, header http.Header) (*http.Response, error), option *SourceHttpOption) (*segmentedBody, error) {
+	size := resp.ContentLength
+	if resp.StatusCode != http.StatusOK || size <= 0 || !strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes") {
+		return nil, nil
+	}
+
+	minSize := option.MinSegmentSize
+	if minSize <= 0 {
+		minSize = defaultMinSegmentSize
+	}
+
+	n := int64(option.Segments)
+	segSize := (size + n - 1) / n
+	if segSize < minSize {
+		segSize = minSize
+		n = (size + segSize - 1) / segSize
+	}
+
+	if n <= 1 {
+		return nil, nil
+	}
+
+	spool, err := ioutil.TempFile("", "file-addr-handler-segment-*")
+	if err != nil {
+		return nil, ErrCodeProtoFileRead.ErrorWithRawErrf(err, "创建分段下载临时文件失败: %s", err.Error())
+	}
+
+	validator := resp.Header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = resp.Header.Get("Last-Modified")
+	}
+
+	segCtx, cancel := context.WithCancel(ctx)
+	b := &segmentedBody{
+		cancel: cancel,
+		first:  resp.Body,
+		firstN: segSize,
+		spool:  spool,
+	}
+	b.cur = io.LimitReader(resp.Body, segSize)
+
+	for start := segSize; start < size; start += segSize {
+		end := start + segSize - 1
+		if end >= size {
+			end = size - 1
+		}
+
+		seg := &httpSegment{start: start, end: end, done: make(chan struct{})}
+		b.segments = append(b.segments, seg)
+
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			defer close(seg.done)
+			seg.err = b.fetch(segCtx, seg, send, validator)
+			if seg.err != nil {
+				cancel()
+			}
+		}()
+	}
+	return b, nil
+}
+
+// fetch 下载一个分段并写入临时文件对应的位置
+func (b *segmentedBody) fetch(ctx context.Context, seg *httpSegment, send func(ctx context.Context, header http.Header) (*http.Response, error), validator string) error {
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", seg.start, seg.end))
+	if validator != "" {
+		header.Set("If-Range", validator)
+	}
+
+	resp, err := send(ctx, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("分段请求返回非法的http响应状态码: %d", resp.StatusCode)
+	}
+
+	var start int64
+	if _, err = fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-", &start); err != nil || start != seg.start {
+		return fmt.Errorf("非法的 Content-Range: %s", resp.Header.Get("Content-Range"))
+	}
+
+	l := seg.end - seg.start + 1
+	written, err := io.Copy(&offsetWriter{w: b.spool, offset: seg.start}, io.LimitReader(resp.Body, l))
+	if err != nil {
+		return err
+	}
+
+	if written != l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// Read 实现io.Reader接口, 按顺序读取各分段
+func (b *segmentedBody) Read(p []byte) (int, error) {
+	for {
+		n, err := b.cur.Read(p)
+		if b.idx == 0 {
+			b.firstN -= int64(n)
+		}
+
+		if err != io.EOF {
+			return n, err
+		}
+
+		if b.idx == 0 && b.firstN > 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+
+		if n > 0 {
+			return n, nil
+		}
+
+		if b.idx >= len(b.segments) {
+			return 0, io.EOF
+		}
+
+		seg := b.segments[b.idx]
+		<-seg.done
+
+		if seg.err != nil {
+			return 0, ErrCodeProtoFileRead.ErrorWithRawErrf(seg.err, "http资源分段[%d-%d]下载失败: %s", seg.start, seg.end, seg.err.Error())
+		}
+
+		if b.idx == 0 {
+			_ = b.first.Close()
+		}
+		b.cur = io.NewSectionReader(b.spool, seg.start, seg.end-seg.start+1)
+		b.idx++
+	}
+}
+
+// Close 结束未完成的分段下载并删除临时文件
+func (b *segmentedBody) Close() error {
+	b.cancel()
+	b.wg.Wait()
+	_ = b.first.Close()
+	_ = b.spool.Close()
+	return os.Remove(b.spool.Name())
+}
+
+// offsetWriter 从指定位置开始写入的写出流
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+// Write 实现io.Writer接口
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.w.WriteAt(p, o.offset)
+	o.offset += int64(n)
+	return n, err
+}
@@ -0,0 +1,72 @@
+package fileaddrhandler
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRangeServer 记录 Range 请求头的http服务
+type testRangeServer struct {
+	lock   sync.Mutex
+	data   []byte
+	ranges []string
+}
+
+func (s *testRangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	s.lock.Unlock()
+
+	w.Header().Set("ETag", `"v1"`)
+	http.ServeContent(w, r, srcFile, time.Time{}, bytes.NewReader(s.data))
+}
+
+func TestParser_SegmentedHttpSource(t *testing.T) {
+	a := assert.New(t)
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	fake := &testRangeServer{data: srcBytes}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	srcUri := server.URL + "/" + srcFile
+	parser := New(FileTypePDF)
+
+	ft, buf, err := parser.CopyToBytesWithOption(WithHttpSourceOption(&SourceHttpOption{Segments: 4, MinSegmentSize: 1024}).SetUri(srcUri))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) || !a.Equal(srcBytes, []byte(buf)) {
+		return
+	}
+
+	sort.Strings(fake.ranges)
+	if !a.Equal([]string{"", "bytes=124277-248553", "bytes=248554-372830", "bytes=372831-497104"}, fake.ranges) {
+		return
+	}
+
+	fake.ranges = nil
+	ft, buf, err = parser.CopyToBytesWithOption(WithHttpSourceOption(&SourceHttpOption{Segments: 4}).SetUri(srcUri))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) || !a.Equal(srcBytes, []byte(buf)) || !a.Equal([]string{""}, fake.ranges) {
+		return
+	}
+
+	_, _, err = New(FileType("504b0304")).CopyToBytesWithOption(WithHttpSourceOption(&SourceHttpOption{Segments: 4, MinSegmentSize: 1024}).SetUri(srcUri))
+	a.True(ErrCodeTargetFileWrite.Equal(err))
+}
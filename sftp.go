@@ -0,0 +1,840 @@
+package fileaddrhandler
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpDialTimeout sftp连接超时时间
+const sftpDialTimeout = 30 * time.Second
+
+// SftpAuth sftp认证选项, 用户名与密码默认取自uri中的用户信息
+type SftpAuth struct {
+	// Password 登录密码, 优先于uri中的密码
+	Password string
+	// PrivateKey PEM格式的私钥内容
+	PrivateKey string
+	// PrivateKeyFile 私钥文件路径
+	PrivateKeyFile string
+	// Passphrase 私钥密码
+	Passphrase string
+	// KnownHostsFile known_hosts文件路径, 为空时使用 ~/.ssh/known_hosts
+	KnownHostsFile string
+	// InsecureIgnoreHostKey 是否跳过服务端公钥校验
+	InsecureIgnoreHostKey bool
+}
+
+// SourceSftpOption 原始文件的sftp选项
+type SourceSftpOption struct {
+	SftpAuth
+}
+
+// TargetSftpOption 目标文件的sftp选项
+type TargetSftpOption struct {
+	SftpAuth
+	// Overwrite 目标文件已存在时是否覆盖, 不覆盖时返回 ErrCodeFileExists
+	Overwrite bool
+}
+
+// clientConfig 构建ssh客户端配置
+func (a *SftpAuth) clientConfig(u *url.URL) (*ssh.ClientConfig, error) {
+	config := &ssh.ClientConfig{
+		Timeout: sftpDialTimeout,
+	}
+
+	password := a.Password
+	if u.User != nil {
+		config.User = u.User.Username()
+		if p, ok := u.User.Password(); ok && password == "" {
+			password = p
+		}
+	}
+
+	keyBytes := []byte(a.PrivateKey)
+	if len(keyBytes) == 0 && a.PrivateKeyFile != "" {
+		var err error
+		if keyBytes, err = os.ReadFile(a.PrivateKeyFile); err != nil {
+			return nil, ErrOption.ErrorWithRawErrf(err, "读取私钥文件[%s]失败: %s", a.PrivateKeyFile, err.Error())
+		}
+	}
+
+	if len(keyBytes) > 0 {
+		var (
+			signer ssh.Signer
+			err    error
+		)
+		if a.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(keyBytes, []byte(a.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(keyBytes)
+		}
+		if err != nil {
+			return nil, ErrOption.ErrorWithRawErrf(err, "解析私钥失败: %s", err.Error())
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	}
+
+	if password != "" {
+		config.Auth = append(config.Auth, ssh.Password(password))
+	}
+
+	if a.InsecureIgnoreHostKey {
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		return config, nil
+	}
+
+	knownHostsFile := a.KnownHostsFile
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, ErrOption.ErrorWithRawErrf(err, "获取用户目录失败: %s", err.Error())
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, ErrOption.ErrorWithRawErrf(err, "加载known_hosts文件[%s]失败: %s", knownHostsFile, err.Error())
+	}
+	config.HostKeyCallback = hostKeyCallback
+	return config, nil
+}
+
+const (
+	sftpPacketInit    = 1
+	sftpPacketVersion = 2
+	sftpPacketOpen    = 3
+	sftpPacketClose   = 4
+	sftpPacketRead    = 5
+	sftpPacketWrite   = 6
+	sftpPacketFstat   = 8
+	sftpPacketRemove  = 13
+	sftpPacketMkdir   = 14
+	sftpPacketStat    = 17
+	sftpPacketStatus  = 101
+	sftpPacketHandle  = 102
+	sftpPacketData    = 103
+	sftpPacketAttrs   = 105
+
+	sftpFlagRead   = 0x01
+	sftpFlagWrite  = 0x02
+	sftpFlagCreate = 0x08
+	sftpFlagTrunc  = 0x10
+
+	sftpAttrSize        = 0x01
+	sftpAttrUidGid      = 0x02
+	sftpAttrPermissions = 0x04
+	sftpAttrModTime     = 0x08
+
+	sftpStatusOk     = 0
+	sftpStatusEOF    = 1
+	sftpStatusNoFile = 2
+
+	// sftpMaxPacket 单次读写的最大数据长度
+	sftpMaxPacket = 32 * 1024
+	// sftpMaxInflight 单个文件同时等待响应的最大读写请求数
+	sftpMaxInflight = 16
+	// sftpMaxRecvPacket 接收的数据包最大长度, 超过时视为非法响应, 避免按服务端声明的长度分配过大的内存
+	sftpMaxRecvPacket = 256*1024 + 1024
+)
+
+// sftpStatusError sftp状态错误
+type sftpStatusError struct {
+	Code uint32
+	Msg  string
+}
+
+// Error 实现error接口
+func (e *sftpStatusError) Error() string {
+	return fmt.Sprintf("sftp状态码[%d]: %s", e.Code, e.Msg)
+}
+
+// isSftpNotFound 判断sftp错误是否为文件不存在
+func isSftpNotFound(err error) bool {
+	e, ok := err.(*sftpStatusError)
+	return ok && e.Code == sftpStatusNoFile
+}
+
+// sftpBuf sftp数据包编解码
+type sftpBuf []byte
+
+func (b *sftpBuf) putUint32(v uint32) {
+	*b = append(*b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (b *sftpBuf) putUint64(v uint64) {
+	b.putUint32(uint32(v >> 32))
+	b.putUint32(uint32(v))
+}
+
+func (b *sftpBuf) putString(s []byte) {
+	b.putUint32(uint32(len(s)))
+	*b = append(*b, s...)
+}
+
+func (b *sftpBuf) uint32() (uint32, error) {
+	if len(*b) < 4 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	v := binary.BigEndian.Uint32(*b)
+	*b = (*b)[4:]
+	return v, nil
+}
+
+func (b *sftpBuf) string() ([]byte, error) {
+	n, err := b.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if uint32(len(*b)) < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	v := (*b)[:n]
+	*b = (*b)[n:]
+	return v, nil
+}
+
+// sftpClient sftp客户端, 文件读写可同时发出多个请求, 响应按请求序号匹配
+type sftpClient struct {
+	lock    sync.Mutex
+	conn    *ssh.Client
+	w       io.WriteCloser
+	r       io.Reader
+	nextId  uint32
+	watcher *contextCloser
+	// early 先于等待顺序到达的响应
+	early map[uint32]sftpResponse
+}
+
+// sftpResponse 已接收的sftp响应
+type sftpResponse struct {
+	t   byte
+	res sftpBuf
+}
+
+// dialSftp 建立ssh连接并打开sftp子系统
+func dialSftp(ctx context.Context, u *url.URL, auth *SftpAuth) (*sftpClient, error) {
+	config, err := auth.clientConfig(u)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+
+	dialer := &net.Dialer{Timeout: sftpDialTimeout}
+	raw, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, ErrCodeSftpConnect.ErrorWithRawErrf(err, "连接sftp服务[%s]失败: %s", addr, err.Error())
+	}
+
+	watcher := watchContext(ctx)
+	watcher.add(raw)
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(raw, addr, config)
+	if err != nil {
+		watcher.Stop()
+		raw.Close()
+		return nil, ErrCodeSftpConnect.ErrorWithRawErrf(err, "连接sftp服务[%s]失败: %s", addr, err.Error())
+	}
+	conn := ssh.NewClient(sshConn, chans, reqs)
+
+	c, err := newSftpClient(conn)
+	if err != nil {
+		watcher.Stop()
+		conn.Close()
+		return nil, ErrCodeSftpConnect.ErrorWithRawErrf(err, "打开sftp子系统失败: %s", err.Error())
+	}
+	c.watcher = watcher
+	return c, nil
+}
+
+func newSftpClient(conn *ssh.Client) (*sftpClient, error) {
+	session, err := conn.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := session.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = session.RequestSubsystem("sftp"); err != nil {
+		return nil, err
+	}
+
+	c := &sftpClient{conn: conn, w: w, r: r}
+
+	var b sftpBuf
+	b.putUint32(3)
+	if err = c.send(sftpPacketInit, b); err != nil {
+		return nil, err
+	}
+
+	t, _, err := c.recv()
+	if err != nil {
+		return nil, err
+	}
+	if t != sftpPacketVersion {
+		return nil, fmt.Errorf("非预期的sftp数据包类型: %d", t)
+	}
+	return c, nil
+}
+
+// Close 关闭连接
+func (c *sftpClient) Close() error {
+	if c.watcher != nil {
+		c.watcher.Stop()
+	}
+	_ = c.w.Close()
+	return c.conn.Close()
+}
+
+func (c *sftpClient) send(t byte, payload []byte) error {
+	var b sftpBuf
+	b.putUint32(uint32(len(payload) + 1))
+	b = append(b, t)
+	b = append(b, payload...)
+	_, err := c.w.Write(b)
+	return err
+}
+
+func (c *sftpClient) recv() (byte, sftpBuf, error) {
+	head := make([]byte, 5)
+	if _, err := io.ReadFull(c.r, head); err != nil {
+		return 0, nil, err
+	}
+
+	n := binary.BigEndian.Uint32(head)
+	if n < 1 {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+
+	if n > sftpMaxRecvPacket {
+		return 0, nil, fmt.Errorf("sftp数据包长度[%d]超过限制[%d]", n, sftpMaxRecvPacket)
+	}
+
+	body := make([]byte, n-1)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return head[4], body, nil
+}
+
+// request 发送请求并读取对应的响应, 状态包为非OK时返回 sftpStatusError
+func (c *sftpClient) request(t byte, fn func(b *sftpBuf)) (byte, sftpBuf, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.requestLocked(t, fn)
+}
+
+// requestLocked 同 request, 调用方需持有锁
+func (c *sftpClient) requestLocked(t byte, fn func(b *sftpBuf)) (byte, sftpBuf, error) {
+	id, err := c.sendRequest(t, fn)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	rt, res, err := c.response(id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err = sftpStatus(rt, res); err != nil {
+		return 0, nil, err
+	}
+	return rt, res, nil
+}
+
+// sendRequest 分配请求序号并发送请求, 调用方需持有锁
+func (c *sftpClient) sendRequest(t byte, fn func(b *sftpBuf)) (uint32, error) {
+	c.nextId++
+	id := c.nextId
+
+	var b sftpBuf
+	b.putUint32(id)
+	fn(&b)
+	return id, c.send(t, b)
+}
+
+// response 读取指定序号的响应, 期间收到的其它响应暂存至 early, 调用方需持有锁
+func (c *sftpClient) response(id uint32) (byte, sftpBuf, error) {
+	if r, ok := c.early[id]; ok {
+		delete(c.early, id)
+		return r.t, r.res, nil
+	}
+
+	for {
+		rt, res, err := c.recv()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		resId, err := res.uint32()
+		if err != nil {
+			return 0, nil, fmt.Errorf("非预期的sftp响应序号")
+		}
+
+		if resId == id {
+			return rt, res, nil
+		}
+
+		if resId > c.nextId {
+			return 0, nil, fmt.Errorf("非预期的sftp响应序号")
+		}
+
+		if c.early == nil {
+			c.early = make(map[uint32]sftpResponse)
+		}
+		c.early[resId] = sftpResponse{t: rt, res: res}
+	}
+}
+
+// sftpStatus 状态包为非OK时返回 sftpStatusError
+func sftpStatus(t byte, res sftpBuf) error {
+	if t != sftpPacketStatus {
+		return nil
+	}
+
+	code, err := res.uint32()
+	if err != nil {
+		return err
+	}
+	if code == sftpStatusOk {
+		return nil
+	}
+	msg, _ := res.string()
+	return &sftpStatusError{Code: code, Msg: string(msg)}
+}
+
+// open 打开远程文件
+func (c *sftpClient) open(p string, flags uint32) (*sftpFile, error) {
+	t, res, err := c.request(sftpPacketOpen, func(b *sftpBuf) {
+		b.putString([]byte(p))
+		b.putUint32(flags)
+		b.putUint32(0)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if t != sftpPacketHandle {
+		return nil, fmt.Errorf("非预期的sftp数据包类型: %d", t)
+	}
+
+	handle, err := res.string()
+	if err != nil {
+		return nil, err
+	}
+	return &sftpFile{c: c, handle: append([]byte(nil), handle...)}, nil
+}
+
+// exists 判断远程文件是否存在
+func (c *sftpClient) exists(p string) (bool, error) {
+	_, _, err := c.request(sftpPacketStat, func(b *sftpBuf) {
+		b.putString([]byte(p))
+	})
+	if err == nil {
+		return true, nil
+	}
+	if isSftpNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// mkdirAll 逐级创建远程目录
+func (c *sftpClient) mkdirAll(dir string) error {
+	dir = path.Clean(dir)
+	if dir == "/" || dir == "." {
+		return nil
+	}
+
+	if exists, err := c.exists(dir); err != nil || exists {
+		return err
+	}
+
+	if err := c.mkdirAll(path.Dir(dir)); err != nil {
+		return err
+	}
+
+	_, _, err := c.request(sftpPacketMkdir, func(b *sftpBuf) {
+		b.putString([]byte(dir))
+		b.putUint32(0)
+	})
+	return err
+}
+
+// remove 删除远程文件
+func (c *sftpClient) remove(p string) error {
+	_, _, err := c.request(sftpPacketRemove, func(b *sftpBuf) {
+		b.putString([]byte(p))
+	})
+	return err
+}
+
+// sftpFile 远程文件, 读取时预先发出多个读请求, 写出时不等待上一个写请求的响应, 写出错误在后续写出或关闭时返回
+type sftpFile struct {
+	c      *sftpClient
+	handle []byte
+	offset uint64
+	// reads 已发出的读请求, 按偏移量排序
+	reads []sftpRead
+	// buf 已读取但未返回的数据
+	buf []byte
+	eof bool
+	// writes 未收到响应的写请求序号
+	writes []uint32
+	err    error
+}
+
+// sftpRead 已发出的读请求
+type sftpRead struct {
+	id     uint32
+	offset uint64
+}
+
+// stat 获取远程文件大小及修改时间, 服务端未提供时大小为-1
+func (f *sftpFile) stat() (int64, time.Time, error) {
+	t, res, err := f.c.request(sftpPacketFstat, func(b *sftpBuf) {
+		b.putString(f.handle)
+	})
+	if err != nil {
+		return -1, time.Time{}, err
+	}
+
+	if t != sftpPacketAttrs {
+		return -1, time.Time{}, fmt.Errorf("非预期的sftp数据包类型: %d", t)
+	}
+
+	flags, err := res.uint32()
+	if err != nil {
+		return -1, time.Time{}, err
+	}
+
+	size := int64(-1)
+	if flags&sftpAttrSize != 0 {
+		h, _ := res.uint32()
+		l, err := res.uint32()
+		if err != nil {
+			return -1, time.Time{}, err
+		}
+		size = int64(uint64(h)<<32 | uint64(l))
+	}
+
+	if flags&sftpAttrUidGid != 0 {
+		_, _ = res.uint32()
+		_, _ = res.uint32()
+	}
+
+	if flags&sftpAttrPermissions != 0 {
+		_, _ = res.uint32()
+	}
+
+	var modTime time.Time
+	if flags&sftpAttrModTime != 0 {
+		_, _ = res.uint32()
+		if mtime, err := res.uint32(); err == nil {
+			modTime = time.Unix(int64(mtime), 0)
+		}
+	}
+	return size, modTime, nil
+}
+
+// Read 实现io.Reader接口
+func (f *sftpFile) Read(p []byte) (int, error) {
+	if len(f.buf) == 0 {
+		if err := f.fill(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	return n, nil
+}
+
+// fill 补足预读请求并读取下一段数据
+func (f *sftpFile) fill() error {
+	f.c.lock.Lock()
+	defer f.c.lock.Unlock()
+
+	for len(f.buf) == 0 {
+		if f.err != nil {
+			return f.err
+		}
+
+		for !f.eof && len(f.reads) < sftpMaxInflight {
+			offset := f.offset
+			if n := len(f.reads); n > 0 {
+				offset = f.reads[n-1].offset + sftpMaxPacket
+			}
+
+			id, err := f.c.sendRequest(sftpPacketRead, func(b *sftpBuf) {
+				b.putString(f.handle)
+				b.putUint64(offset)
+				b.putUint32(sftpMaxPacket)
+			})
+			if err != nil {
+				f.err = err
+				return err
+			}
+			f.reads = append(f.reads, sftpRead{id: id, offset: offset})
+		}
+
+		if len(f.reads) == 0 {
+			return io.EOF
+		}
+
+		read := f.reads[0]
+		f.reads = f.reads[1:]
+		t, res, err := f.c.response(read.id)
+		if err == nil {
+			err = sftpStatus(t, res)
+		}
+
+		if e, ok := err.(*sftpStatusError); ok && e.Code == sftpStatusEOF {
+			f.eof = true
+			continue
+		}
+
+		if err == nil && t != sftpPacketData {
+			err = fmt.Errorf("非预期的sftp数据包类型: %d", t)
+		}
+
+		var data []byte
+		if err == nil {
+			data, err = res.string()
+		}
+
+		if err != nil {
+			f.err = err
+			return err
+		}
+
+		f.buf = data
+		f.offset = read.offset + uint64(len(data))
+		if len(data) < sftpMaxPacket && len(f.reads) > 0 {
+			// 服务端返回的数据少于请求长度时, 丢弃后续预读, 从实际读取位置继续
+			if err = f.discardReads(); err != nil {
+				f.err = err
+				return err
+			}
+			f.eof = false
+		}
+	}
+	return nil
+}
+
+// discardReads 丢弃已发出的读请求的响应, 调用方需持有锁
+func (f *sftpFile) discardReads() error {
+	for _, read := range f.reads {
+		if _, _, err := f.c.response(read.id); err != nil {
+			return err
+		}
+	}
+	f.reads = nil
+	return nil
+}
+
+// Write 实现io.Writer接口
+func (f *sftpFile) Write(p []byte) (int, error) {
+	f.c.lock.Lock()
+	defer f.c.lock.Unlock()
+
+	written := 0
+	for len(p) > 0 {
+		if f.err != nil {
+			return written, f.err
+		}
+
+		if len(f.writes) >= sftpMaxInflight {
+			if f.err = f.ackWrite(); f.err != nil {
+				return written, f.err
+			}
+		}
+
+		chunk := p
+		if len(chunk) > sftpMaxPacket {
+			chunk = chunk[:sftpMaxPacket]
+		}
+
+		id, err := f.c.sendRequest(sftpPacketWrite, func(b *sftpBuf) {
+			b.putString(f.handle)
+			b.putUint64(f.offset)
+			b.putString(chunk)
+		})
+		if err != nil {
+			f.err = err
+			return written, err
+		}
+
+		f.writes = append(f.writes, id)
+		f.offset += uint64(len(chunk))
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// ackWrite 等待最早的写请求的响应, 调用方需持有锁
+func (f *sftpFile) ackWrite() error {
+	id := f.writes[0]
+	f.writes = f.writes[1:]
+	t, res, err := f.c.response(id)
+	if err != nil {
+		return err
+	}
+	return sftpStatus(t, res)
+}
+
+// Close 等待未完成的读写请求后关闭远程文件, 返回首个写出错误
+func (f *sftpFile) Close() error {
+	f.c.lock.Lock()
+	defer f.c.lock.Unlock()
+
+	err := f.err
+	for len(f.writes) > 0 {
+		if ackErr := f.ackWrite(); err == nil {
+			err = ackErr
+		}
+	}
+
+	if discardErr := f.discardReads(); discardErr != nil {
+		return discardErr
+	}
+
+	if _, _, closeErr := f.c.requestLocked(sftpPacketClose, func(b *sftpBuf) {
+		b.putString(f.handle)
+	}); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// readSftpSource 读取sftp协议文件
+func readSftpSource(req *SourceRequest, fn func(r io.Reader) error) error {
+	var (
+		option *SourceSftpOption
+		err    error
+		u      = req.URL
+	)
+	if option, err = parseOptionData[SourceSftpOption](req.Data); err != nil {
+		return err
+	}
+
+	if option == nil {
+		option = &SourceSftpOption{}
+	}
+
+	c, err := dialSftp(requestContext(req.Context), u, &option.SftpAuth)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	f, err := c.open(u.Path, sftpFlagRead)
+	if err != nil {
+		if isSftpNotFound(err) {
+			return ErrCodeProtoFileNoExist.ErrorWithRawErrf(err, "sftp资源[%s]不存在", u.Path)
+		}
+		return ErrCodeProtoFileOpen.ErrorWithRawErrf(err, "打开sftp资源[%s]失败: %s", u.Path, err.Error())
+	}
+	defer f.Close()
+
+	if size, modTime, err := f.stat(); err == nil {
+		req.Size, req.ModTime = size, modTime
+	}
+	return fn(f)
+}
+
+// sftpLazyWriter 首次写出时才创建目录并打开远程文件, 避免文件类型校验失败时在服务端留下空文件
+type sftpLazyWriter struct {
+	c    *sftpClient
+	path string
+	f    *sftpFile
+}
+
+// Write 实现io.Writer接口
+func (w *sftpLazyWriter) Write(b []byte) (int, error) {
+	if w.f == nil {
+		if err := w.c.mkdirAll(path.Dir(w.path)); err != nil {
+			return 0, err
+		}
+		f, err := w.c.open(w.path, sftpFlagWrite|sftpFlagCreate|sftpFlagTrunc)
+		if err != nil {
+			return 0, err
+		}
+		w.f = f
+	}
+	return w.f.Write(b)
+}
+
+// writeSftpTarget 写出到sftp协议地址
+func writeSftpTarget(req *TargetRequest, r io.Reader) (FileType, error) {
+	var (
+		option *TargetSftpOption
+		err    error
+		u      = req.URL
+	)
+	if option, err = parseOptionData[TargetSftpOption](req.Data); err != nil {
+		return "", err
+	}
+
+	if option == nil {
+		option = &TargetSftpOption{}
+	}
+
+	c, err := dialSftp(requestContext(req.Context), u, &option.SftpAuth)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+
+	if !option.Overwrite {
+		exists, err := c.exists(u.Path)
+		if err != nil {
+			return "", ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "检查sftp目标文件[%s]失败: %s", u.Path, err.Error())
+		}
+		if exists {
+			return "", ErrCodeFileExists.Errorf("sftp目标文件[%s]已存在", u.Path)
+		}
+	}
+
+	w := &sftpLazyWriter{c: c, path: u.Path}
+	fileType, err := req.Copy(r, w)
+	if w.f == nil {
+		return fileType, err
+	}
+
+	closeErr := w.f.Close()
+	if err != nil {
+		_ = c.remove(u.Path)
+		return "", err
+	}
+
+	if closeErr != nil {
+		return "", ErrCodeTargetFileWrite.ErrorWithRawErrf(closeErr, "向sftp目标文件[%s]写出内容失败: %s", u.Path, closeErr.Error())
+	}
+	return fileType, nil
+}
@@ -0,0 +1,511 @@
+package fileaddrhandler
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSftpServer 测试使用的简易sftp服务
+type testSftpServer struct {
+	ln             net.Listener
+	root           string
+	knownHostsFile string
+	clientKeyPem   string
+}
+
+func newTestSftpServer(t *testing.T) *testSftpServer {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientSigner, err := ssh.NewSignerFromKey(clientPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKeyBlock, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "test" && string(password) == "123456" {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(clientSigner.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	s := &testSftpServer{
+		ln:             ln,
+		root:           filepath.Join(dir, "root"),
+		knownHostsFile: filepath.Join(dir, "known_hosts"),
+		clientKeyPem:   string(pem.EncodeToMemory(clientKeyBlock)),
+	}
+
+	if err = os.Mkdir(s.root, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(ln.Addr().String())}, hostSigner.PublicKey())
+	if err = ioutil.WriteFile(s.knownHostsFile, []byte(line+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn, config)
+		}
+	}()
+	return s
+}
+
+func (s *testSftpServer) Close() {
+	_ = s.ln.Close()
+}
+
+func (s *testSftpServer) URL(user, p string) string {
+	return "sftp://" + user + "@" + s.ln.Addr().String() + p
+}
+
+func (s *testSftpServer) localPath(p string) string {
+	return filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+p)))
+}
+
+func (s *testSftpServer) handle(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+				if ok {
+					go s.serve(channel)
+				}
+			}
+		}()
+	}
+}
+
+func (s *testSftpServer) serve(channel ssh.Channel) {
+	defer channel.Close()
+
+	handles := make(map[string]*os.File)
+	nextHandle := 0
+
+	send := func(t byte, payload sftpBuf) {
+		var b sftpBuf
+		b.putUint32(uint32(len(payload) + 1))
+		b = append(b, t)
+		b = append(b, payload...)
+		_, _ = channel.Write(b)
+	}
+
+	status := func(id uint32, err error) {
+		var b sftpBuf
+		b.putUint32(id)
+		switch {
+		case err == nil:
+			b.putUint32(sftpStatusOk)
+		case err == io.EOF:
+			b.putUint32(sftpStatusEOF)
+		case os.IsNotExist(err):
+			b.putUint32(sftpStatusNoFile)
+		default:
+			b.putUint32(4)
+		}
+		b.putString([]byte(""))
+		b.putString([]byte(""))
+		send(sftpPacketStatus, b)
+	}
+
+	uint64Of := func(b *sftpBuf) uint64 {
+		h, _ := b.uint32()
+		l, _ := b.uint32()
+		return uint64(h)<<32 | uint64(l)
+	}
+
+	for {
+		head := make([]byte, 5)
+		if _, err := io.ReadFull(channel, head); err != nil {
+			return
+		}
+		body := make(sftpBuf, int(head[0])<<24|int(head[1])<<16|int(head[2])<<8|int(head[3])-1)
+		if _, err := io.ReadFull(channel, body); err != nil {
+			return
+		}
+
+		if head[4] == sftpPacketInit {
+			var b sftpBuf
+			b.putUint32(3)
+			send(sftpPacketVersion, b)
+			continue
+		}
+
+		id, _ := body.uint32()
+		switch head[4] {
+		case sftpPacketOpen:
+			p, _ := body.string()
+			pflags, _ := body.uint32()
+			flags := os.O_RDONLY
+			if pflags&sftpFlagWrite != 0 {
+				flags = os.O_WRONLY
+			}
+			if pflags&sftpFlagCreate != 0 {
+				flags |= os.O_CREATE
+			}
+			if pflags&sftpFlagTrunc != 0 {
+				flags |= os.O_TRUNC
+			}
+			f, err := os.OpenFile(s.localPath(string(p)), flags, 0644)
+			if err != nil {
+				status(id, err)
+				continue
+			}
+			nextHandle++
+			handle := strconv.Itoa(nextHandle)
+			handles[handle] = f
+			var b sftpBuf
+			b.putUint32(id)
+			b.putString([]byte(handle))
+			send(sftpPacketHandle, b)
+		case sftpPacketRead:
+			handle, _ := body.string()
+			offset := uint64Of(&body)
+			length, _ := body.uint32()
+			buf := make([]byte, length)
+			n, err := handles[string(handle)].ReadAt(buf, int64(offset))
+			if n == 0 {
+				status(id, err)
+				continue
+			}
+			var b sftpBuf
+			b.putUint32(id)
+			b.putString(buf[:n])
+			send(sftpPacketData, b)
+		case sftpPacketWrite:
+			handle, _ := body.string()
+			offset := uint64Of(&body)
+			data, _ := body.string()
+			_, err := handles[string(handle)].WriteAt(data, int64(offset))
+			status(id, err)
+		case sftpPacketFstat:
+			handle, _ := body.string()
+			stat, err := handles[string(handle)].Stat()
+			if err != nil {
+				status(id, err)
+				continue
+			}
+			var b sftpBuf
+			b.putUint32(id)
+			b.putUint32(sftpAttrSize | sftpAttrModTime)
+			b.putUint64(uint64(stat.Size()))
+			b.putUint32(uint32(stat.ModTime().Unix()))
+			b.putUint32(uint32(stat.ModTime().Unix()))
+			send(sftpPacketAttrs, b)
+		case sftpPacketClose:
+			handle, _ := body.string()
+			err := handles[string(handle)].Close()
+			delete(handles, string(handle))
+			status(id, err)
+		case sftpPacketStat:
+			p, _ := body.string()
+			if _, err := os.Stat(s.localPath(string(p))); err != nil {
+				status(id, err)
+				continue
+			}
+			var b sftpBuf
+			b.putUint32(id)
+			b.putUint32(0)
+			send(sftpPacketAttrs, b)
+		case sftpPacketMkdir:
+			p, _ := body.string()
+			status(id, os.Mkdir(s.localPath(string(p)), 0755))
+		case sftpPacketRemove:
+			p, _ := body.string()
+			status(id, os.Remove(s.localPath(string(p))))
+		default:
+			status(id, os.ErrInvalid)
+		}
+	}
+}
+
+func TestParser_SftpProtoRead(t *testing.T) {
+	defer os.RemoveAll(targetFile)
+
+	a := assert.New(t)
+
+	server := newTestSftpServer(t)
+	defer server.Close()
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.NoError(os.MkdirAll(server.localPath("/in"), 0755)) {
+		return
+	}
+
+	if !a.NoError(ioutil.WriteFile(server.localPath("/in/"+srcFile), srcBytes, 0644)) {
+		return
+	}
+
+	parser := New(FileTypePDF)
+
+	auth := SftpAuth{KnownHostsFile: server.knownHostsFile}
+
+	_, err = parser.CopyWithOption(WithSftpSourceOption(&SourceSftpOption{SftpAuth: auth}).SetUri(server.URL("test:123456", "/in/"+targetFile)),
+		WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.True(ErrCodeProtoFileNoExist.Equal(err)) {
+		return
+	}
+
+	_, err = parser.CopyWithOption(WithSftpSourceOption(&SourceSftpOption{SftpAuth: auth}).SetUri(server.URL("test:bad", "/in/"+srcFile)),
+		WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.True(ErrCodeSftpConnect.Equal(err)) {
+		return
+	}
+
+	otherKnownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	if !a.NoError(ioutil.WriteFile(otherKnownHosts, nil, 0644)) {
+		return
+	}
+	_, err = parser.CopyWithOption(WithSftpSourceOption(&SourceSftpOption{SftpAuth: SftpAuth{KnownHostsFile: otherKnownHosts}}).SetUri(server.URL("test:123456", "/in/"+srcFile)),
+		WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.True(ErrCodeSftpConnect.Equal(err)) {
+		return
+	}
+
+	total := int64(0)
+	parser.SetProgress(func(progress Progress) {
+		total = progress.Total
+	}, time.Hour)
+	ft, err := parser.CopyWithOption(WithSftpSourceOption(&SourceSftpOption{SftpAuth: auth}).SetUri(server.URL("test:123456", "/in/"+srcFile)),
+		WithEmptyTargetOption().SetUri("file://"+targetFile))
+	parser.SetProgress(nil, 0)
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) || !a.Equal(int64(len(srcBytes)), total) {
+		return
+	}
+
+	targetBytes, err := ioutil.ReadFile(targetFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(srcBytes, targetBytes) {
+		return
+	}
+
+	keyAuth := SftpAuth{KnownHostsFile: server.knownHostsFile, PrivateKey: server.clientKeyPem}
+	ft, buf, err := parser.CopyToBytesWithOption(WithSftpSourceOption(&SourceSftpOption{SftpAuth: keyAuth}).SetUri(server.URL("test", "/in/"+srcFile)))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) {
+		return
+	}
+
+	a.Equal(srcBytes, []byte(buf))
+}
+
+func TestCopyToSftp(t *testing.T) {
+	a := assert.New(t)
+
+	server := newTestSftpServer(t)
+	defer server.Close()
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	if !a.NoError(ioutil.WriteFile(keyFile, []byte(server.clientKeyPem), 0600)) {
+		return
+	}
+
+	parser := New(FileTypePDF)
+
+	targetUri := server.URL("test", "/out/sub/"+targetFile)
+	option := &TargetSftpOption{SftpAuth: SftpAuth{KnownHostsFile: server.knownHostsFile, PrivateKeyFile: keyFile}}
+
+	ft, err := parser.CopyWithOption(WithEmptySourceOption().SetUri("file://"+srcFile), WithSftpTargetOption(option).SetUri(targetUri))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) {
+		return
+	}
+
+	targetBytes, err := ioutil.ReadFile(server.localPath("/out/sub/" + targetFile))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(srcBytes, targetBytes) {
+		return
+	}
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri("file://"+srcFile), WithSftpTargetOption(option).SetUri(targetUri))
+	if !a.True(ErrCodeFileExists.Equal(err)) {
+		return
+	}
+
+	option.Overwrite = true
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri("file://"+srcFile), WithSftpTargetOption(option).SetUri(targetUri))
+	if !a.NoError(err) {
+		return
+	}
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetReader(strings.NewReader("not a pdf file")),
+		WithSftpTargetOption(option).SetUri(server.URL("test", "/other.pdf")))
+	if !a.True(ErrCodeUnsupportedFileType.Equal(err)) {
+		return
+	}
+
+	_, err = os.Stat(server.localPath("/other.pdf"))
+	a.True(os.IsNotExist(err))
+}
+
+func TestSftpClient_RecvPacketLimit(t *testing.T) {
+	a := assert.New(t)
+
+	head := make([]byte, 5)
+	binary.BigEndian.PutUint32(head, 0xffffffff)
+	head[4] = sftpPacketData
+	c := &sftpClient{r: bytes.NewReader(head)}
+	_, _, err := c.recv()
+	a.Error(err)
+}
+
+// testSftpConn 测试使用的sftp连接, 记录发出的请求并返回预置的响应
+type testSftpConn struct {
+	bytes.Buffer
+}
+
+func (c *testSftpConn) Close() error {
+	return nil
+}
+
+// testSftpPacket 构建sftp数据包
+func testSftpPacket(t byte, id uint32, fn func(b *sftpBuf)) []byte {
+	var payload sftpBuf
+	payload.putUint32(id)
+	fn(&payload)
+
+	var b sftpBuf
+	b.putUint32(uint32(len(payload) + 1))
+	b = append(b, t)
+	return append(b, payload...)
+}
+
+func TestSftpFile_Pipeline(t *testing.T) {
+	a := assert.New(t)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), sftpMaxPacket/16)
+
+	// 响应乱序到达, 读取方仍按偏移顺序返回数据
+	var responses []byte
+	for i := sftpMaxInflight; i > 0; i-- {
+		responses = append(responses, testSftpPacket(sftpPacketData, uint32(i), func(b *sftpBuf) {
+			b.putString(data)
+		})...)
+	}
+
+	conn := &testSftpConn{}
+	c := &sftpClient{w: conn, r: bytes.NewReader(responses)}
+	f := &sftpFile{c: c, handle: []byte("1")}
+
+	buf := make([]byte, sftpMaxPacket)
+	n, err := io.ReadFull(f, buf)
+	if !a.NoError(err) || !a.Equal(data, buf[:n]) {
+		return
+	}
+
+	// 首个响应返回前已发出全部预读请求
+	sent := sftpBuf(conn.Bytes())
+	count := 0
+	for len(sent) > 0 {
+		size, err := sent.uint32()
+		if !a.NoError(err) {
+			return
+		}
+		sent = sent[size:]
+		count++
+	}
+	a.Equal(sftpMaxInflight, count)
+
+	// 写出请求不等待响应
+	conn.Reset()
+	c = &sftpClient{w: conn, r: bytes.NewReader(nil)}
+	f = &sftpFile{c: c, handle: []byte("1")}
+	n, err = f.Write(bytes.Repeat(data, 4))
+	a.NoError(err)
+	a.Equal(4*len(data), n)
+	a.Len(f.writes, 4)
+}
@@ -0,0 +1,98 @@
+package fileaddrhandler
+
+import "io"
+
+// sizeLimit 文件大小限制, 为0时表示不限制
+type sizeLimit struct {
+	min int64
+	max int64
+}
+
+// newSizeLimit 创建文件大小限制, 均不限制时返回nil
+func newSizeLimit(min, max int64) *sizeLimit {
+	if min <= 0 && max <= 0 {
+		return nil
+	}
+	return &sizeLimit{min: min, max: max}
+}
+
+// check 校验已知的文件大小, 未知时为-1
+func (l *sizeLimit) check(size int64) error {
+	if size < 0 {
+		return nil
+	}
+
+	if l.max > 0 && size > l.max {
+		return ErrCodeFileSize.Errorf("文件大小[%d]超过限制的最大值[%d]", size, l.max)
+	}
+
+	if l.min > 0 && size < l.min {
+		return ErrCodeFileSize.Errorf("文件大小[%d]小于限制的最小值[%d]", size, l.min)
+	}
+	return nil
+}
+
+// SetSizeLimit 设置文件大小限制, min 用于拒绝被截断的文件, max 用于拒绝过大的文件, 为0时不限制
+func (p *Parser) SetSizeLimit(min, max int64) {
+	p.sizeLimit = newSizeLimit(min, max)
+}
+
+// sizeLimitReader 读取过程中校验文件大小的读取流
+type sizeLimitReader struct {
+	r      io.Reader
+	limits []*sizeLimit
+	max    int64
+	n      int64
+}
+
+// newSizeLimitReader 校验已知大小并包装读取流, 选项中的限制优先于解析器的限制, 均未设置时原样返回
+func (p *Parser) newSizeLimitReader(r io.Reader, size int64, optionLimits ...*sizeLimit) (io.Reader, error) {
+	var limits []*sizeLimit
+	for _, limit := range optionLimits {
+		if limit != nil {
+			limits = append(limits, limit)
+		}
+	}
+
+	if len(limits) == 0 && p.sizeLimit != nil {
+		limits = append(limits, p.sizeLimit)
+	}
+
+	if len(limits) == 0 {
+		return r, nil
+	}
+
+	lr := &sizeLimitReader{r: r, limits: limits, max: -1}
+	for _, limit := range limits {
+		if err := limit.check(size); err != nil {
+			return nil, err
+		}
+
+		if limit.max > 0 && (lr.max < 0 || limit.max < lr.max) {
+			lr.max = limit.max
+		}
+	}
+	return lr, nil
+}
+
+// Read 实现io.Reader接口, 超过最大值时立即中断, 读取结束时校验最小值
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	if l.max >= 0 && int64(len(p)) > l.max-l.n+1 {
+		p = p[:l.max-l.n+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.max >= 0 && l.n > l.max {
+		return 0, ErrCodeFileSize.Errorf("文件大小超过限制的最大值[%d]", l.max)
+	}
+
+	if err == io.EOF {
+		for _, limit := range l.limits {
+			if checkErr := limit.check(l.n); checkErr != nil {
+				return n, checkErr
+			}
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,96 @@
+package fileaddrhandler
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParser_SizeLimit(t *testing.T) {
+	a := assert.New(t)
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+	size := int64(len(srcBytes))
+
+	rangeServer := httptest.NewServer(&testRangeServer{data: srcBytes})
+	defer rangeServer.Close()
+
+	chunkedServer := httptest.NewServer(downloadHttpHandFunc)
+	defer chunkedServer.Close()
+
+	parser := New(FileTypePDF)
+	parser.SetSizeLimit(0, 1024)
+
+	_, _, err = parser.CopyToBytes(rangeServer.URL + "/" + srcFile)
+	if !a.True(ErrCodeFileSize.Equal(err)) {
+		return
+	}
+
+	_, _, err = parser.CopyToBytes(chunkedServer.URL + "/" + srcFile)
+	if !a.True(ErrCodeFileSize.Equal(err)) {
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri(chunkedServer.URL+"/"+srcFile), WithEmptyTargetOption().SetWriter(buf))
+	if !a.True(ErrCodeFileSize.Equal(err)) || !a.LessOrEqual(buf.Len(), 1024) {
+		return
+	}
+
+	ft, res, err := parser.CopyToBytesWithOption(WithEmptySourceOption().SetUri(chunkedServer.URL+"/"+srcFile).SetSizeLimit(0, size))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) || !a.Equal(srcBytes, []byte(res)) {
+		return
+	}
+
+	parser.SetSizeLimit(size+1, 0)
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri("file://"+srcFile), WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.True(ErrCodeFileSize.Equal(err)) {
+		return
+	}
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetReader(&testOnlyReader{r: bytes.NewReader(srcBytes)}), WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.True(ErrCodeFileSize.Equal(err)) {
+		return
+	}
+
+	parser.SetSizeLimit(0, 0)
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetReader(&testOnlyReader{r: bytes.NewReader(srcBytes)}),
+		WithEmptyTargetOption().SetWriter(ioutil.Discard).SetSizeLimit(size, size))
+	a.NoError(err)
+}
+
+func TestParser_SizeLimitHttpTarget(t *testing.T) {
+	a := assert.New(t)
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	uploadServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = ioutil.ReadAll(request.Body)
+		writer.WriteHeader(200)
+	}))
+	defer uploadServer.Close()
+
+	parser := New(FileTypePDF)
+	parser.SetSizeLimit(0, 1024)
+
+	for _, mode := range []HttpBodyMode{HttpBodyMultipart, HttpBodyRaw, HttpBodyBase64Json} {
+		_, err = parser.CopyWithOption(WithEmptySourceOption().SetReader(&testOnlyReader{r: bytes.NewReader(srcBytes)}),
+			WithHttpTargetOption(&TargetHttpOption{BodyMode: mode}).SetUri(uploadServer.URL+"/"+targetFile))
+		if !a.True(ErrCodeFileSize.Equal(err), "%s: %v", mode, err) {
+			return
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package fileaddrhandler
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+const (
+	// sm3Size SM3摘要长度
+	sm3Size = 32
+	// sm3BlockSize SM3分组长度
+	sm3BlockSize = 64
+)
+
+// sm3IV SM3初始值
+var sm3IV = [8]uint32{
+	0x7380166f, 0x4914b2b9, 0x172442d7, 0xda8a0600,
+	0xa96f30bc, 0x163138aa, 0xe38dee4d, 0xb0fb0e4e,
+}
+
+// sm3Digest SM3摘要计算, 实现 GB/T 32905-2016
+type sm3Digest struct {
+	v   [8]uint32
+	buf [sm3BlockSize]byte
+	nx  int
+	len uint64
+}
+
+// newSm3 创建SM3摘要计算
+func newSm3() hash.Hash {
+	d := &sm3Digest{}
+	d.Reset()
+	return d
+}
+
+// Reset 实现hash.Hash接口
+func (d *sm3Digest) Reset() {
+	d.v = sm3IV
+	d.nx = 0
+	d.len = 0
+}
+
+// Size 实现hash.Hash接口
+func (d *sm3Digest) Size() int {
+	return sm3Size
+}
+
+// BlockSize 实现hash.Hash接口
+func (d *sm3Digest) BlockSize() int {
+	return sm3BlockSize
+}
+
+// Write 实现io.Writer接口
+func (d *sm3Digest) Write(p []byte) (int, error) {
+	n := len(p)
+	d.len += uint64(n)
+
+	if d.nx > 0 {
+		c := copy(d.buf[d.nx:], p)
+		d.nx += c
+		p = p[c:]
+		if d.nx == sm3BlockSize {
+			d.block(d.buf[:])
+			d.nx = 0
+		}
+	}
+
+	for len(p) >= sm3BlockSize {
+		d.block(p[:sm3BlockSize])
+		p = p[sm3BlockSize:]
+	}
+
+	if len(p) > 0 {
+		d.nx = copy(d.buf[:], p)
+	}
+	return n, nil
+}
+
+// Sum 实现hash.Hash接口
+func (d *sm3Digest) Sum(in []byte) []byte {
+	c := *d
+
+	l := c.len
+	var pad [sm3BlockSize + 8]byte
+	pad[0] = 0x80
+	padLen := sm3BlockSize - int((l+8)%sm3BlockSize)
+	if padLen == 0 {
+		padLen = sm3BlockSize
+	}
+	binary.BigEndian.PutUint64(pad[padLen:], l<<3)
+	_, _ = c.Write(pad[:padLen+8])
+
+	var out [sm3Size]byte
+	for i, v := range c.v {
+		binary.BigEndian.PutUint32(out[i*4:], v)
+	}
+	return append(in, out[:]...)
+}
+
+// block 压缩一个分组
+func (d *sm3Digest) block(p []byte) {
+	var w [68]uint32
+	for i := 0; i < 16; i++ {
+		w[i] = binary.BigEndian.Uint32(p[i*4:])
+	}
+
+	for j := 16; j < 68; j++ {
+		x := w[j-16] ^ w[j-9] ^ bits.RotateLeft32(w[j-3], 15)
+		w[j] = x ^ bits.RotateLeft32(x, 15) ^ bits.RotateLeft32(x, 23) ^ bits.RotateLeft32(w[j-13], 7) ^ w[j-6]
+	}
+
+	a, b, c, dd, e, f, g, h := d.v[0], d.v[1], d.v[2], d.v[3], d.v[4], d.v[5], d.v[6], d.v[7]
+	for j := 0; j < 64; j++ {
+		var t, ff, gg uint32
+		if j < 16 {
+			t = 0x79cc4519
+			ff = a ^ b ^ c
+			gg = e ^ f ^ g
+		} else {
+			t = 0x7a879d8a
+			ff = (a & b) | (a & c) | (b & c)
+			gg = (e & f) | (^e & g)
+		}
+
+		a12 := bits.RotateLeft32(a, 12)
+		ss1 := bits.RotateLeft32(a12+e+bits.RotateLeft32(t, j%32), 7)
+		ss2 := ss1 ^ a12
+		tt1 := ff + dd + ss2 + (w[j] ^ w[j+4])
+		tt2 := gg + h + ss1 + w[j]
+
+		dd = c
+		c = bits.RotateLeft32(b, 9)
+		b = a
+		a = tt1
+		h = g
+		g = bits.RotateLeft32(f, 19)
+		f = e
+		e = tt2 ^ bits.RotateLeft32(tt2, 9) ^ bits.RotateLeft32(tt2, 17)
+	}
+
+	d.v[0] ^= a
+	d.v[1] ^= b
+	d.v[2] ^= c
+	d.v[3] ^= dd
+	d.v[4] ^= e
+	d.v[5] ^= f
+	d.v[6] ^= g
+	d.v[7] ^= h
+}
@@ -0,0 +1,35 @@
+package fileaddrhandler
+
+import (
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestSm3(t *testing.T) {
+	a := assert.New(t)
+
+	vectors := map[string]string{
+		"":                         "1ab21d8355cfa17f8e61194831e81a8f22bec8c728fefb747ed035eb5082aa2b",
+		"abc":                      "66c7f0f462eeedd9d1f2d46bdc10e4e24167c4875cf2f7a2297da02b8f4ba8e0",
+		strings.Repeat("abcd", 16): "debe9ff92275b8a138604889c18e5a4d6fdb70e5387e5765293dcba39c0c5732",
+	}
+
+	for msg, sum := range vectors {
+		h := newSm3()
+		_, _ = h.Write([]byte(msg))
+		if !a.Equal(sum, hex.EncodeToString(h.Sum(nil)), msg) {
+			return
+		}
+
+		// 分段写入与一次写入结果一致
+		h.Reset()
+		for i := 0; i < len(msg); i++ {
+			_, _ = h.Write([]byte{msg[i]})
+		}
+		if !a.Equal(sum, hex.EncodeToString(h.Sum(nil)), msg) {
+			return
+		}
+	}
+}
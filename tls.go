@@ -0,0 +1,219 @@
+package fileaddrhandler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// TLSOption https请求的tls选项, 默认校验服务端证书
+type TLSOption struct {
+	// RootCAs PEM格式的根证书内容, 与 RootCAFile 同时设置时均生效
+	RootCAs string
+	// RootCAFile PEM格式的根证书文件路径
+	RootCAFile string
+	// Cert PEM格式的客户端证书内容
+	Cert string
+	// Key PEM格式的客户端私钥内容
+	Key string
+	// CertFile 客户端证书文件路径
+	CertFile string
+	// KeyFile 客户端私钥文件路径
+	KeyFile string
+	// ServerName 校验证书时使用的服务端名称
+	ServerName string
+	// InsecureSkipVerify 跳过服务端证书校验, 仅在明确知道风险时开启
+	InsecureSkipVerify bool
+}
+
+// Config 构建tls配置
+func (t *TLSOption) Config() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.RootCAs != "" || t.RootCAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		if t.RootCAs != "" && !pool.AppendCertsFromPEM([]byte(t.RootCAs)) {
+			return nil, ErrOption.Error("解析根证书内容失败")
+		}
+
+		if t.RootCAFile != "" {
+			caBytes, err := os.ReadFile(t.RootCAFile)
+			if err != nil {
+				return nil, ErrOption.ErrorWithRawErrf(err, "读取根证书文件[%s]失败: %s", t.RootCAFile, err.Error())
+			}
+			if !pool.AppendCertsFromPEM(caBytes) {
+				return nil, ErrOption.Errorf("解析根证书文件[%s]失败", t.RootCAFile)
+			}
+		}
+		config.RootCAs = pool
+	}
+
+	var (
+		cert tls.Certificate
+		err  error
+	)
+	switch {
+	case t.Cert != "" || t.Key != "":
+		cert, err = tls.X509KeyPair([]byte(t.Cert), []byte(t.Key))
+	case t.CertFile != "" || t.KeyFile != "":
+		cert, err = tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	default:
+		return config, nil
+	}
+
+	if err != nil {
+		return nil, ErrOption.ErrorWithRawErrf(err, "加载客户端证书失败: %s", err.Error())
+	}
+	config.Certificates = []tls.Certificate{cert}
+	return config, nil
+}
+
+// newTLSHttpClient 基于已有的客户端构建使用指定tls配置的客户端
+func newTLSHttpClient(base *http.Client, option *TLSOption) (*http.Client, error) {
+	transport, err := newTLSTransport(base.Transport, option)
+	if err != nil {
+		return nil, err
+	}
+
+	client := *base
+	client.Transport = transport
+	return &client, nil
+}
+
+// newTLSTransport 基于已有的传输层构建使用指定tls配置的传输层
+func newTLSTransport(base http.RoundTripper, option *TLSOption) (*http.Transport, error) {
+	config, err := option.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	var transport *http.Transport
+	switch t := base.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return nil, ErrOption.Errorf("自定义的传输层[%T]不支持设置tls选项", t)
+	}
+	transport.TLSClientConfig = config
+	return transport, nil
+}
+
+// maxTLSTransports tls传输层缓存的最大数量
+const maxTLSTransports = 16
+
+// tlsTransportKey 缓存tls传输层的键
+type tlsTransportKey struct {
+	base   *http.Transport
+	option TLSOption
+}
+
+// tlsTransportEntry 缓存的tls传输层
+type tlsTransportEntry struct {
+	transport *http.Transport
+	// stamp 证书文件的修改时间及大小, 文件变化后重新构建传输层
+	stamp string
+}
+
+// tlsFileStamp 获取tls选项中证书文件的修改时间及大小
+func tlsFileStamp(option *TLSOption) string {
+	var stamp strings.Builder
+	for _, name := range []string{option.RootCAFile, option.CertFile, option.KeyFile} {
+		if name == "" {
+			continue
+		}
+
+		if stat, err := os.Stat(name); err == nil {
+			_, _ = fmt.Fprintf(&stamp, "%s:%d:%d;", name, stat.ModTime().UnixNano(), stat.Size())
+		} else {
+			_, _ = fmt.Fprintf(&stamp, "%s:-;", name)
+		}
+	}
+	return stamp.String()
+}
+
+// tlsHttpClient 获取使用指定tls配置的客户端, 基于解析器自身客户端时相同的tls选项复用同一传输层, 避免每次操作新建连接池, 证书文件变化后重新构建
+func (p *Parser) tlsHttpClient(base *http.Client, option *TLSOption) (*http.Client, error) {
+	if p == nil {
+		return newTLSHttpClient(base, option)
+	}
+
+	// 选项中自定义的客户端或传输层由调用方管理, 不缓存
+	t, ok := base.Transport.(*http.Transport)
+	if own, _ := p.httpClient.Transport.(*http.Transport); !ok || t != own {
+		return newTLSHttpClient(base, option)
+	}
+
+	key := tlsTransportKey{base: t, option: *option}
+	stamp := tlsFileStamp(option)
+
+	p.tlsLock.Lock()
+	defer p.tlsLock.Unlock()
+
+	entry, ok := p.tlsTransports[key]
+	if !ok || entry.stamp != stamp {
+		transport, err := newTLSTransport(base.Transport, option)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			p.removeTLSTransport(key)
+		}
+		p.addTLSTransport(key, &tlsTransportEntry{transport: transport, stamp: stamp})
+		entry = p.tlsTransports[key]
+	}
+
+	client := *base
+	client.Transport = entry.transport
+	return &client, nil
+}
+
+// addTLSTransport 缓存tls传输层, 移除基于已替换的解析器传输层的缓存, 超出最大数量时移除最早的缓存
+func (p *Parser) addTLSTransport(key tlsTransportKey, entry *tlsTransportEntry) {
+	for i := 0; i < len(p.tlsTransportKeys); {
+		if k := p.tlsTransportKeys[i]; k.base != key.base {
+			p.removeTLSTransport(k)
+			continue
+		}
+		i++
+	}
+
+	for len(p.tlsTransportKeys) >= maxTLSTransports {
+		p.removeTLSTransport(p.tlsTransportKeys[0])
+	}
+
+	if p.tlsTransports == nil {
+		p.tlsTransports = make(map[tlsTransportKey]*tlsTransportEntry)
+	}
+	p.tlsTransports[key] = entry
+	p.tlsTransportKeys = append(p.tlsTransportKeys, key)
+}
+
+// removeTLSTransport 移除缓存的tls传输层并关闭其空闲连接
+func (p *Parser) removeTLSTransport(key tlsTransportKey) {
+	entry, ok := p.tlsTransports[key]
+	if !ok {
+		return
+	}
+
+	entry.transport.CloseIdleConnections()
+	delete(p.tlsTransports, key)
+	for i, k := range p.tlsTransportKeys {
+		if k == key {
+			p.tlsTransportKeys = append(p.tlsTransportKeys[:i], p.tlsTransportKeys[i+1:]...)
+			break
+		}
+	}
+}
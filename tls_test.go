@@ -0,0 +1,226 @@
+package fileaddrhandler
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testServerCertPem 获取测试https服务的PEM格式证书
+func testServerCertPem(server *httptest.Server) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+}
+
+// testClientCertPem 生成测试使用的自签名客户端证书及私钥
+func testClientCertPem() (*x509.Certificate, string, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	return cert,
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})),
+		nil
+}
+
+func TestParser_TLSOption(t *testing.T) {
+	a := assert.New(t)
+
+	server := httptest.NewTLSServer(downloadHttpHandFunc)
+	defer server.Close()
+
+	srcUri := server.URL + "/" + srcFile
+
+	parser := New(FileTypePDF)
+	_, err := parser.CopyWithOption(WithEmptySourceOption().SetUri(srcUri), WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.True(ErrCodeHttpRequest.Equal(err)) {
+		return
+	}
+
+	ft, err := parser.CopyWithOption(WithHttpSourceOption(&SourceHttpOption{TLS: &TLSOption{InsecureSkipVerify: true}}).SetUri(srcUri),
+		WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) {
+		return
+	}
+
+	_, err = parser.CopyWithOption(WithHttpSourceOption(&SourceHttpOption{TLS: &TLSOption{InsecureSkipVerify: true}}).SetUri(srcUri),
+		WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.NoError(err) || !a.Len(parser.tlsTransports, 1) {
+		return
+	}
+
+	_, err = parser.CopyWithOption(WithHttpSourceOption(&SourceHttpOption{TLS: &TLSOption{RootCAs: "bad ca"}}).SetUri(srcUri),
+		WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.True(ErrOption.Equal(err)) || !a.Len(parser.tlsTransports, 1) {
+		return
+	}
+
+	if err = parser.SetTLSOption(&TLSOption{RootCAs: testServerCertPem(server)}); !a.NoError(err) {
+		return
+	}
+
+	ft, err = parser.CopyWithOption(WithEmptySourceOption().SetUri(srcUri), WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.NoError(err) {
+		return
+	}
+
+	a.Equal(FileTypePDF, ft)
+}
+
+func TestParser_TLSClientCert(t *testing.T) {
+	a := assert.New(t)
+
+	clientCert, certPem, keyPem, err := testClientCertPem()
+	if !a.NoError(err) {
+		return
+	}
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	server := httptest.NewUnstartedServer(downloadHttpHandFunc)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	srcUri := server.URL + "/" + srcFile
+
+	parser := New(FileTypePDF)
+	if err = parser.SetTLSOption(&TLSOption{RootCAs: testServerCertPem(server)}); !a.NoError(err) {
+		return
+	}
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri(srcUri), WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.True(ErrCodeHttpRequest.Equal(err)) {
+		return
+	}
+
+	if err = parser.SetTLSOption(&TLSOption{RootCAs: testServerCertPem(server), Cert: certPem, Key: keyPem}); !a.NoError(err) {
+		return
+	}
+
+	ft, err := parser.CopyWithOption(WithEmptySourceOption().SetUri(srcUri), WithEmptyTargetOption().SetWriter(ioutil.Discard))
+	if !a.NoError(err) {
+		return
+	}
+
+	a.Equal(FileTypePDF, ft)
+}
+
+func TestParser_TLSTransportCache(t *testing.T) {
+	a := assert.New(t)
+
+	parser := New(FileTypePDF)
+	client, err := parser.httpClientFor(nil, nil, &TLSOption{ServerName: "a"})
+	if !a.NoError(err) {
+		return
+	}
+
+	cached, err := parser.httpClientFor(nil, nil, &TLSOption{ServerName: "a"})
+	if !a.NoError(err) || !a.Same(client.Transport, cached.Transport) {
+		return
+	}
+
+	// 选项中自定义的传输层不缓存
+	_, err = parser.httpClientFor(nil, http.DefaultTransport.(*http.Transport).Clone(), &TLSOption{ServerName: "a"})
+	if !a.NoError(err) || !a.Len(parser.tlsTransports, 1) {
+		return
+	}
+
+	for i := 0; i < maxTLSTransports*2; i++ {
+		if _, err = parser.httpClientFor(nil, nil, &TLSOption{ServerName: strconv.Itoa(i)}); !a.NoError(err) {
+			return
+		}
+	}
+
+	if !a.Len(parser.tlsTransports, maxTLSTransports) || !a.Len(parser.tlsTransportKeys, maxTLSTransports) {
+		return
+	}
+
+	// 证书文件变化后重新读取
+	_, certPem, _, err := testClientCertPem()
+	if !a.NoError(err) {
+		return
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if !a.NoError(ioutil.WriteFile(caFile, []byte(certPem), 0644)) {
+		return
+	}
+
+	option := &TLSOption{RootCAFile: caFile}
+	client, err = parser.httpClientFor(nil, nil, option)
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.NoError(ioutil.WriteFile(caFile, []byte("bad ca"), 0644)) || !a.NoError(os.Chtimes(caFile, time.Now(), time.Now().Add(time.Hour))) {
+		return
+	}
+
+	_, err = parser.httpClientFor(nil, nil, option)
+	if !a.True(ErrOption.Equal(err)) {
+		return
+	}
+
+	if !a.NoError(ioutil.WriteFile(caFile, []byte(certPem), 0644)) || !a.NoError(os.Chtimes(caFile, time.Now(), time.Now().Add(2*time.Hour))) {
+		return
+	}
+
+	cached, err = parser.httpClientFor(nil, nil, option)
+	if !a.NoError(err) || !a.NotSame(client.Transport, cached.Transport) {
+		return
+	}
+
+	// 替换解析器的客户端后移除旧的缓存
+	parser.SetHttpClient(nil)
+	if _, err = parser.httpClientFor(nil, nil, option); !a.NoError(err) {
+		return
+	}
+	a.Len(parser.tlsTransports, 1)
+}
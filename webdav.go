@@ -0,0 +1,380 @@
+package fileaddrhandler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// TargetWebdavOption 目标文件的webdav选项
+type TargetWebdavOption struct {
+	// Headers 请求头
+	Headers map[string]string
+	// Overwrite 目标文件已存在时是否覆盖, 不覆盖时返回 ErrCodeFileExists
+	Overwrite bool
+	// TLS tls选项, 为空时使用解析器的配置
+	TLS *TLSOption
+	// Client http客户端, 为空时使用解析器的客户端
+	Client *http.Client `json:"-"`
+	// Transport http传输层, 不为空时替换客户端的传输层
+	Transport http.RoundTripper `json:"-"`
+	// Retry 重试策略, 为空时使用解析器的配置
+	Retry *RetryPolicy
+}
+
+// webdavHttpUrl 将webdav(s)地址转换为http(s)地址, 用户信息转换为Basic认证
+func webdavHttpUrl(u *url.URL) (*url.URL, *url.Userinfo) {
+	httpUrl := *u
+	httpUrl.Scheme = "http"
+	if u.Scheme == "webdavs" {
+		httpUrl.Scheme = "https"
+	}
+	httpUrl.User = nil
+	return &httpUrl, u.User
+}
+
+// readWebdavSource 读取webdav(s)协议文件
+func readWebdavSource(req *SourceRequest, fn func(r io.Reader) error) error {
+	var (
+		option *SourceHttpOption
+		err    error
+	)
+	if option, err = parseOptionData[SourceHttpOption](req.Data); err != nil {
+		return err
+	}
+
+	if option == nil {
+		option = &SourceHttpOption{}
+	}
+
+	httpUrl, user := webdavHttpUrl(req.URL)
+	if user != nil {
+		password, _ := user.Password()
+		authReq := &http.Request{Header: http.Header{}}
+		authReq.SetBasicAuth(user.Username(), password)
+
+		headers := option.Headers.Clone()
+		if headers == nil {
+			headers = http.Header{}
+		}
+		headers.Set("Authorization", authReq.Header.Get("Authorization"))
+		authOption := *option
+		authOption.Headers = headers
+		option = &authOption
+	}
+
+	httpReq := &SourceRequest{
+		Uri:     httpUrl.String(),
+		URL:     httpUrl,
+		Data:    option,
+		Parser:  req.Parser,
+		Context: req.Context,
+		Size:    -1,
+	}
+	return readHttpSource(httpReq, func(r io.Reader) error {
+		req.Size = httpReq.Size
+		req.ModTime = httpReq.ModTime
+		return fn(r)
+	})
+}
+
+// webdavClient webdav请求客户端
+type webdavClient struct {
+	ctx     context.Context
+	client  *http.Client
+	retry   *RetryPolicy
+	user    *url.Userinfo
+	headers map[string]string
+}
+
+// do 发送webdav请求并按重试策略重试, 请求体在重试时从头重放
+func (c *webdavClient) do(method string, uri string, body io.Reader, header http.Header) (*http.Response, error) {
+	var replay *webdavReplayBody
+	if body != nil && c.retry != nil && c.retry.MaxAttempts > 1 {
+		replay = &webdavReplayBody{replay: newReplayReader(body)}
+		defer replay.Close()
+	}
+
+	send := func() (*http.Response, error) {
+		reqBody := body
+		if replay != nil {
+			var err error
+			if reqBody, err = replay.open(); err != nil {
+				return nil, ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "重放源文件内容失败: %s", err.Error())
+			}
+		}
+
+		req, err := http.NewRequestWithContext(c.ctx, method, uri, reqBody)
+		if err != nil {
+			return nil, err
+		}
+
+		if replay != nil {
+			req.GetBody = replay.open
+		}
+
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+
+		for k := range header {
+			req.Header.Set(k, header.Get(k))
+		}
+
+		if c.user != nil {
+			password, _ := c.user.Password()
+			req.SetBasicAuth(c.user.Username(), password)
+		}
+
+		res, err := c.client.Do(req)
+		if err != nil && replay != nil {
+			// 源文件读取失败时重试无意义, 直接返回读取错误
+			if srcErr := replay.stop(); srcErr != nil {
+				if _, ok := ErrParse(srcErr); ok {
+					return nil, srcErr
+				}
+				return nil, ErrCodeTargetFileWrite.ErrorWithRawErrf(srcErr, "读取源文件内容失败: %s", srcErr.Error())
+			}
+		}
+		return res, err
+	}
+	return c.retry.do(c.ctx, send)
+}
+
+// webdavReplayBody 可重放的webdav请求体, 每次请求通过独立的管道读取, 重放前结束上一次的读取
+type webdavReplayBody struct {
+	replay *replayReader
+	src    io.Reader
+	srcErr error
+	pipeR  *io.PipeReader
+	done   chan struct{}
+}
+
+// open 获取从头开始的请求体
+func (b *webdavReplayBody) open() (io.ReadCloser, error) {
+	b.stop()
+
+	src, err := b.replay.reader()
+	if err != nil {
+		return nil, err
+	}
+	b.src = src
+
+	pipeR, pipeW := io.Pipe()
+	b.pipeR, b.done = pipeR, make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		_, err := io.Copy(pipeW, webdavSourceReader{b})
+		_ = pipeW.CloseWithError(err)
+	}(b.done)
+	return pipeR, nil
+}
+
+// stop 结束当前的读取, 返回读取源文件时的错误
+func (b *webdavReplayBody) stop() error {
+	if b.pipeR != nil {
+		_ = b.pipeR.CloseWithError(io.ErrClosedPipe)
+		<-b.done
+		b.pipeR = nil
+	}
+	return b.srcErr
+}
+
+// Close 结束读取并删除重放缓存
+func (b *webdavReplayBody) Close() error {
+	b.stop()
+	return b.replay.Close()
+}
+
+// webdavSourceReader 记录源文件读取错误的读取流
+type webdavSourceReader struct {
+	b *webdavReplayBody
+}
+
+// Read 实现io.Reader接口
+func (r webdavSourceReader) Read(p []byte) (int, error) {
+	n, err := r.b.src.Read(p)
+	if err != nil && err != io.EOF {
+		r.b.srcErr = err
+	}
+	return n, err
+}
+
+// exists 通过PROPFIND判断资源是否存在
+func (c *webdavClient) exists(uri string) (bool, error) {
+	res, err := c.do("PROPFIND", uri, nil, http.Header{"Depth": {"0"}})
+	if err != nil {
+		return false, err
+	}
+	res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return false, nil
+	case res.StatusCode >= 200 && res.StatusCode <= 299:
+		return true, nil
+	default:
+		return false, ErrCodeResStatusCode.Errorf("非法的webdav响应状态码: %d", res.StatusCode)
+	}
+}
+
+// remove 删除写出失败的资源, 上下文已结束时仍需清理服务端的文件
+func (c *webdavClient) remove(uri string) {
+	c.ctx = context.Background()
+	if res, err := c.do(http.MethodDelete, uri, nil, nil); err == nil {
+		res.Body.Close()
+	}
+}
+
+// mkcolAll 逐级创建上级集合
+func (c *webdavClient) mkcolAll(u *url.URL) error {
+	dirs := strings.Split(strings.Trim(path.Dir(u.Path), "/"), "/")
+	colUrl := *u
+	colUrl.Path, colUrl.RawPath = "", ""
+	for _, dir := range dirs {
+		if dir == "" || dir == "." {
+			continue
+		}
+		colUrl.Path += "/" + dir
+
+		res, err := c.do("MKCOL", colUrl.String()+"/", nil, nil)
+		if err != nil {
+			return ErrCodeMkdir.ErrorWithRawErrf(err, "创建webdav集合[%s]失败: %s", colUrl.Path, err.Error())
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusMethodNotAllowed {
+			return ErrCodeMkdir.Errorf("创建webdav集合[%s]失败, 响应状态码: %d", colUrl.Path, res.StatusCode)
+		}
+	}
+	return nil
+}
+
+// webdavLazyWriter 首次写出时才创建上级集合并发起PUT请求, 避免文件类型校验失败时在服务端留下空集合或空文件
+type webdavLazyWriter struct {
+	c         *webdavClient
+	u         *url.URL
+	overwrite bool
+	pipeW     *io.PipeWriter
+	ch        chan *webdavPutResult
+	// exists 服务端因目标文件已存在拒绝了写入
+	exists bool
+}
+
+type webdavPutResult struct {
+	res *http.Response
+	err error
+}
+
+// Write 实现io.Writer接口
+func (w *webdavLazyWriter) Write(b []byte) (int, error) {
+	if w.pipeW == nil {
+		if err := w.c.mkcolAll(w.u); err != nil {
+			return 0, err
+		}
+
+		header := http.Header{}
+		if w.overwrite {
+			header.Set("Overwrite", "T")
+		} else {
+			header.Set("Overwrite", "F")
+			header.Set("If-None-Match", "*")
+		}
+
+		pipeR, pipeW := io.Pipe()
+		w.pipeW = pipeW
+		w.ch = make(chan *webdavPutResult, 1)
+		go func() {
+			res, err := w.c.do(http.MethodPut, w.u.String(), pipeR, header)
+			_ = pipeR.CloseWithError(io.ErrClosedPipe)
+			w.ch <- &webdavPutResult{res: res, err: err}
+		}()
+	}
+	return w.pipeW.Write(b)
+}
+
+// finish 结束写出并等待服务端响应
+func (w *webdavLazyWriter) finish(copyErr error) error {
+	_ = w.pipeW.CloseWithError(copyErr)
+	result := <-w.ch
+	if result.err != nil {
+		return result.err
+	}
+	defer result.res.Body.Close()
+
+	if result.res.StatusCode == http.StatusPreconditionFailed {
+		w.exists = true
+		return ErrCodeFileExists.Errorf("webdav目标文件[%s]已存在", w.u.Path)
+	}
+
+	if result.res.StatusCode < 200 || result.res.StatusCode > 299 {
+		return ErrCodeTargetFileWrite.Errorf("服务器返回错误的状态码: %d", result.res.StatusCode)
+	}
+	return nil
+}
+
+// writeWebdavTarget 写出到webdav(s)协议地址
+func writeWebdavTarget(req *TargetRequest, r io.Reader) (FileType, error) {
+	var (
+		option *TargetWebdavOption
+		err    error
+	)
+	if option, err = parseOptionData[TargetWebdavOption](req.Data); err != nil {
+		return "", err
+	}
+
+	if option == nil {
+		option = &TargetWebdavOption{}
+	}
+
+	client, err := req.Parser.httpClientFor(option.Client, option.Transport, option.TLS)
+	if err != nil {
+		return "", err
+	}
+
+	httpUrl, user := webdavHttpUrl(req.URL)
+	c := &webdavClient{
+		ctx:     requestContext(req.Context),
+		client:  client,
+		retry:   req.Parser.retryPolicyFor(option.Retry),
+		user:    user,
+		headers: option.Headers,
+	}
+
+	if !option.Overwrite {
+		exists, err := c.exists(httpUrl.String())
+		if err != nil {
+			return "", ErrCodeTargetFileWrite.ErrorWithRawErrf(err, "检查webdav目标文件[%s]失败: %s", httpUrl.Path, err.Error())
+		}
+		if exists {
+			return "", ErrCodeFileExists.Errorf("webdav目标文件[%s]已存在", httpUrl.Path)
+		}
+	}
+
+	w := &webdavLazyWriter{c: c, u: httpUrl, overwrite: option.Overwrite}
+	fileType, err := req.Copy(r, w)
+	if w.pipeW == nil {
+		return fileType, err
+	}
+
+	finishErr := w.finish(err)
+	if err != nil || (finishErr != nil && !w.exists) {
+		c.remove(httpUrl.String())
+	}
+
+	if _, ok := ErrParse(finishErr); ok {
+		return "", finishErr
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if finishErr != nil {
+		return "", ErrCodeTargetFileWrite.ErrorWithRawErrf(finishErr, "向webdav目标文件[%s]写出内容失败: %s", httpUrl.Path, finishErr.Error())
+	}
+	return fileType, nil
+}
@@ -0,0 +1,265 @@
+package fileaddrhandler
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testWebdavServer 测试使用的简易webdav服务
+type testWebdavServer struct {
+	lock        sync.Mutex
+	collections map[string]struct{}
+	files       map[string][]byte
+	// failPuts 需要返回503的PUT请求次数
+	failPuts int
+	// partialPuts 保存部分内容后返回500的PUT请求次数
+	partialPuts int
+	puts        int
+}
+
+func (s *testWebdavServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if user, password, ok := r.BasicAuth(); !ok || user != "test" || password != "123456" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	p := strings.TrimSuffix(r.URL.Path, "/")
+	_, isCollection := s.collections[p]
+	data, isFile := s.files[p]
+
+	switch r.Method {
+	case "PROPFIND":
+		if !isCollection && !isFile {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+	case "MKCOL":
+		if isCollection || isFile {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := s.collections[path.Dir(p)]; !ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		s.collections[p] = struct{}{}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodPut:
+		s.puts++
+		if s.failPuts > 0 {
+			s.failPuts--
+			_, _ = ioutil.ReadAll(io.LimitReader(r.Body, 1024))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if s.partialPuts > 0 {
+			s.partialPuts--
+			s.files[p], _ = ioutil.ReadAll(io.LimitReader(r.Body, 1024))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if _, ok := s.collections[path.Dir(p)]; !ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if isFile && r.Header.Get("If-None-Match") == "*" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		s.files[p] = body
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		if !isFile {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.files, p)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet:
+		if !isFile {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// testWebdavCreateReader 首次读取时在服务端创建指定文件, 模拟拷贝期间出现的同名文件
+type testWebdavCreateReader struct {
+	r    io.Reader
+	fake *testWebdavServer
+	path string
+	data []byte
+}
+
+func (c *testWebdavCreateReader) Read(p []byte) (int, error) {
+	if c.path != "" {
+		c.fake.lock.Lock()
+		c.fake.files[c.path] = c.data
+		c.fake.lock.Unlock()
+		c.path = ""
+	}
+	return c.r.Read(p)
+}
+
+func TestParser_WebdavProto(t *testing.T) {
+	a := assert.New(t)
+
+	fake := &testWebdavServer{collections: map[string]struct{}{"/": {}}, files: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	davUri := strings.Replace(server.URL, "http://", "webdav://test:123456@", 1)
+	parser := New(FileTypePDF)
+
+	ft, err := parser.CopyByURI("file://"+srcFile, davUri+"/docs/in/"+srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) {
+		return
+	}
+
+	if !a.Equal(srcBytes, fake.files["/docs/in/"+srcFile]) {
+		return
+	}
+
+	_, err = parser.CopyByURI("file://"+srcFile, davUri+"/docs/in/"+srcFile)
+	if !a.True(ErrCodeFileExists.Equal(err)) {
+		return
+	}
+
+	ft, err = parser.CopyWithOption(WithEmptySourceOption().SetUri("file://"+srcFile),
+		WithWebdavTargetOption(&TargetWebdavOption{Overwrite: true}).SetUri(davUri+"/docs/in/"+srcFile))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) {
+		return
+	}
+
+	_, err = parser.CopyByURI("file://"+srcFile, strings.Replace(davUri, "123456", "bad", 1)+"/docs/other.pdf")
+	if !a.Error(err) {
+		return
+	}
+
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetReader(strings.NewReader("not a pdf file")),
+		WithEmptyTargetOption().SetUri(davUri+"/docs/new/other.pdf"))
+	if !a.True(ErrCodeUnsupportedFileType.Equal(err)) {
+		return
+	}
+
+	if _, ok := fake.files["/docs/new/other.pdf"]; !a.False(ok) {
+		return
+	}
+
+	if _, ok := fake.collections["/docs/new"]; !a.False(ok) {
+		return
+	}
+
+	// 写出失败时删除服务端已保存的部分内容
+	fake.partialPuts = 1
+	_, err = parser.CopyByURI("file://"+srcFile, davUri+"/docs/partial.pdf")
+	if !a.True(ErrCodeTargetFileWrite.Equal(err)) {
+		return
+	}
+
+	if _, ok := fake.files["/docs/partial.pdf"]; !a.False(ok) {
+		return
+	}
+
+	// 检查后出现的同名文件由服务端拒绝写入且不会被删除
+	other := []byte("created during copy")
+	src := &testWebdavCreateReader{r: strings.NewReader(string(srcBytes)), fake: fake, path: "/docs/race.pdf", data: other}
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetReader(src), WithEmptyTargetOption().SetUri(davUri+"/docs/race.pdf"))
+	if !a.True(ErrCodeFileExists.Equal(err)) {
+		return
+	}
+
+	if !a.Equal(other, fake.files["/docs/race.pdf"]) {
+		return
+	}
+
+	ft, buf, err := parser.CopyToBytes(davUri + "/docs/in/" + srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) {
+		return
+	}
+
+	if !a.Equal(srcBytes, []byte(buf)) {
+		return
+	}
+
+	_, _, err = parser.CopyToBytes(davUri + "/docs/in/" + targetFile)
+	a.True(ErrCodeProtoFileNoExist.Equal(err))
+}
+
+func TestParser_WebdavRetryPut(t *testing.T) {
+	a := assert.New(t)
+
+	fake := &testWebdavServer{collections: map[string]struct{}{"/": {}}, files: make(map[string][]byte), failPuts: 2}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	srcBytes, err := ioutil.ReadFile(srcFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	davUri := strings.Replace(server.URL, "http://", "webdav://test:123456@", 1)
+	parser := New(FileTypePDF)
+	parser.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+	ft, err := parser.CopyWithOption(WithEmptySourceOption().SetReader(ioutil.NopCloser(strings.NewReader(string(srcBytes)))),
+		WithEmptyTargetOption().SetUri(davUri+"/docs/"+srcFile))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.Equal(FileTypePDF, ft) || !a.Equal(3, fake.puts) {
+		return
+	}
+
+	if !a.Equal(srcBytes, fake.files["/docs/"+srcFile]) {
+		return
+	}
+
+	fake.failPuts = 3
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetUri("file://"+srcFile),
+		WithWebdavTargetOption(&TargetWebdavOption{Overwrite: true}).SetUri(davUri+"/docs/"+srcFile))
+	if !a.True(ErrCodeTargetFileWrite.Equal(err)) {
+		return
+	}
+
+	// 源文件读取失败时不重试
+	parser.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour})
+	parser.SetSizeLimit(0, int64(len(srcBytes)/2))
+	_, err = parser.CopyWithOption(WithEmptySourceOption().SetReader(ioutil.NopCloser(strings.NewReader(string(srcBytes)))),
+		WithWebdavTargetOption(&TargetWebdavOption{Overwrite: true}).SetUri(davUri+"/docs/"+srcFile))
+	a.True(ErrCodeFileSize.Equal(err))
+}